@@ -0,0 +1,47 @@
+package main
+
+import "log"
+
+// scoringJob identifies a stored receipt waiting to be scored by the background workers (ASYNC_SCORING)
+type scoringJob struct {
+	store *receiptStore
+	id    string
+}
+
+// scoringJobs holds the receipts waiting to be scored
+var scoringJobs = make(chan scoringJob, 1000)
+
+// startScoringWorkers launches n goroutines that score queued receipts and cache their points
+func startScoringWorkers(n int) {
+	if n < 1 {
+		n = 1
+	}
+	for i := 0; i < n; i++ {
+		go scoringWorker()
+	}
+}
+
+// scoringWorker scores each queued receipt. A receipt that fails to score is no longer marked pending,
+// so the points endpoint recalculates it and reports the error to the client.
+func scoringWorker() {
+	for job := range scoringJobs {
+		r, err := getReceiptById(job.store, job.id)
+		if err != nil {
+			continue // deleted before it was scored
+		}
+		if _, err := pointsFor(job.store, r); err != nil {
+			log.Printf("async scoring: unable to calculate points for %s: %v", job.id, err)
+			job.store.clearPending(job.id)
+		}
+	}
+}
+
+// enqueueScoring queues a receipt stored in s for background scoring. When the queue is full the receipt is
+// left to be scored on its first points request instead of blocking the caller.
+func enqueueScoring(s *receiptStore, id string) {
+	select {
+	case scoringJobs <- scoringJob{store: s, id: id}:
+	default:
+		s.clearPending(id)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// workersStarted makes sure only one background scoring worker is started however often the tests run
+var workersStarted sync.Once
+
+func TestAsyncScoring(t *testing.T) {
+	resetState(t)
+	appSettings.AsyncScoring = true
+
+	recorder := doRequest(t, http.MethodPost, "/receipts/process", targetReceipt)
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("process returned %d, want 202", recorder.Code)
+	}
+	var id returnID
+	decodeBody(t, recorder, &id)
+
+	// no worker has picked the receipt up yet
+	pending := doRequest(t, http.MethodGet, "/receipts/"+id.ID+"/points", "")
+	var status struct {
+		Status string `json:"status"`
+	}
+	decodeBody(t, pending, &status)
+	if pending.Code != http.StatusAccepted || status.Status != "pending" {
+		t.Fatalf("points right after submit returned %d %q, want 202 pending", pending.Code, status.Status)
+	}
+
+	workersStarted.Do(func() { startScoringWorkers(1) })
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		recorder := doRequest(t, http.MethodGet, "/receipts/"+id.ID+"/points", "")
+		if recorder.Code == http.StatusOK {
+			var points returnPoints
+			decodeBody(t, recorder, &points)
+			if points.Points != 28 {
+				t.Errorf("points = %d, want 28", points.Points)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("points still returned %d after 2s", recorder.Code)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
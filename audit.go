@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// operations recorded in the audit log
+const (
+	auditCreate  = "create"
+	auditUpdate  = "update"
+	auditDelete  = "delete"
+	auditRestore = "restore"
+)
+
+// auditEntry is one line of the audit log
+type auditEntry struct {
+	Timestamp time.Time `json:"timestamp"`
+	Operation string    `json:"operation"`
+	ReceiptID string    `json:"receiptId"`
+	RequestID string    `json:"requestId"`
+	Tenant    string    `json:"tenant,omitempty"`
+}
+
+// auditLog is where audit entries are appended as JSON lines; nil disables auditing.
+// It is a variable so tests can capture entries in a buffer.
+var auditLog io.Writer
+
+// auditMu serializes writes so concurrent entries never interleave
+var auditMu sync.Mutex
+
+// openAuditLog returns the writer for the AUDIT_LOG setting: nil when unset, stdout for "stdout",
+// and otherwise the named file opened for appending
+func openAuditLog(path string) (io.Writer, error) {
+	switch path {
+	case "":
+		return nil, nil
+	case "stdout":
+		return os.Stdout, nil
+	}
+	return os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+}
+
+// recordAudit appends an entry for a mutating operation on a receipt made by the current request
+func recordAudit(context *gin.Context, operation string, receiptID string) {
+	writeAudit(auditEntry{
+		Operation: operation,
+		ReceiptID: receiptID,
+		RequestID: context.GetString(requestIDKey),
+		Tenant:    context.GetString(tenantKey),
+	})
+}
+
+// writeAudit timestamps an entry and appends it to the audit log; it's used directly by ingestion paths
+// that don't run in a request, such as the queue consumer
+func writeAudit(entry auditEntry) {
+	if auditLog == nil {
+		return
+	}
+
+	entry.Timestamp = now().UTC()
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("audit: unable to encode entry for %s: %v", entry.ReceiptID, err)
+		return
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	if _, err := auditLog.Write(append(line, '\n')); err != nil {
+		log.Printf("audit: unable to write entry for %s: %v", entry.ReceiptID, err)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+	resetState(t)
+	audit := &bytes.Buffer{}
+	auditLog = audit
+
+	id := processTestReceipt(t, targetReceipt, "X-Request-ID", "process-1")
+	doRequest(t, http.MethodPut, "/receipts/"+id, cornerMarketReceipt, "X-Request-ID", "update-1")
+	doRequest(t, http.MethodPost, "/receipts/delete", `{"ids": ["`+id+`"]}`, "X-Request-ID", "delete-1")
+
+	want := []struct{ operation, requestID string }{
+		{auditCreate, "process-1"},
+		{auditUpdate, "update-1"},
+		{auditDelete, "delete-1"},
+	}
+	lines := strings.Split(strings.TrimSuffix(audit.String(), "\n"), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("audit log has %d entries, want %d: %q", len(lines), len(want), audit.String())
+	}
+	for i, line := range lines {
+		var entry auditEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("entry %q isn't JSON: %v", line, err)
+		}
+		if entry.Operation != want[i].operation || entry.RequestID != want[i].requestID ||
+			entry.ReceiptID != id || entry.Timestamp.IsZero() {
+			t.Errorf("entry %d = %+v, want %s of %s by request %s", i, entry, want[i].operation, id, want[i].requestID)
+		}
+	}
+}
+
+func TestAuditLogSkipsRejectedReceipts(t *testing.T) {
+	resetState(t)
+	audit := &bytes.Buffer{}
+	auditLog = audit
+
+	doRequest(t, http.MethodPost, "/receipts/process", `{"retailer": ""}`)
+	if audit.Len() != 0 {
+		t.Errorf("audit log = %q for a rejected receipt, want nothing", audit.String())
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+// compositeRule awards Bonus when every one of its conditions holds for a receipt
+type compositeRule struct {
+	Name       string          `json:"name"`
+	Conditions []ruleCondition `json:"conditions"`
+	Bonus      int             `json:"bonus"`
+}
+
+// ruleCondition compares a receipt field against a value.
+// Fields: totalCents, cents (the cents part of the total), itemCount, day, hour.
+// Ops: eq, ne, lt, lte, gt, gte, multipleOf.
+type ruleCondition struct {
+	Field string `json:"field"`
+	Op    string `json:"op"`
+	Value int64  `json:"value"`
+}
+
+// conditionFields and conditionOps are the fields and ops a ruleCondition may use
+var (
+	conditionFields = map[string]bool{"totalCents": true, "cents": true, "itemCount": true, "day": true, "hour": true}
+	conditionOps    = map[string]bool{"eq": true, "ne": true, "lt": true, "lte": true, "gt": true, "gte": true, "multipleOf": true}
+)
+
+// UnmarshalJSON rejects conditions with an unknown field or op as the config is read, so a typo fails
+// startup or the request supplying the config rather than every receipt scored with it
+func (c *ruleCondition) UnmarshalJSON(data []byte) error {
+	// decode through an alias type so this method isn't called recursively
+	type plainCondition ruleCondition
+	var condition plainCondition
+	if err := json.Unmarshal(data, &condition); err != nil {
+		return err
+	}
+
+	if !conditionFields[condition.Field] {
+		return errors.New("unknown composite rule field " + strconv.Quote(condition.Field))
+	}
+	if !conditionOps[condition.Op] {
+		return errors.New("unknown composite rule op " + strconv.Quote(condition.Op))
+	}
+	*c = ruleCondition(condition)
+	return nil
+}
+
+// compositeRulesRule sums the bonuses of every configured composite rule the receipt satisfies
+func compositeRulesRule(r *receipt, config ScoringConfig, history receiptHistory) (int, error) {
+	points := 0
+	for _, rule := range config.CompositeRules {
+		matched, err := rule.matches(r)
+		if err != nil {
+			return 0, err
+		}
+		if matched {
+			points += rule.Bonus
+		}
+	}
+	return points, nil
+}
+
+// matches reports whether all of the rule's conditions hold (an empty rule never matches). An hour
+// condition is unmet rather than an error for lenient receipts without a purchase time.
+func (c compositeRule) matches(r *receipt) (bool, error) {
+	if len(c.Conditions) == 0 {
+		return false, nil
+	}
+
+	for _, condition := range c.Conditions {
+		if condition.Field == "hour" && missingTime(r) {
+			return false, nil
+		}
+		value, err := conditionField(r, condition.Field)
+		if err != nil {
+			return false, err
+		}
+		ok, err := compare(value, condition.Op, condition.Value)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// conditionField extracts the named numeric field from a receipt
+func conditionField(r *receipt, field string) (int64, error) {
+	switch field {
+	case "totalCents", "cents":
+		totalCents, err := parseCents(r.Total)
+		if err != nil {
+			return 0, errInvalidTotal
+		}
+		if field == "cents" {
+			return totalCents % 100, nil
+		}
+		return totalCents, nil
+	case "itemCount":
+		return int64(len(r.Items)), nil
+	case "day":
+		purchaseDate, err := programDate(r)
+		if err != nil {
+			return 0, err
+		}
+		return int64(purchaseDate.Day()), nil
+	case "hour":
+		purchaseTime, err := programTime(r)
+		if err != nil {
+			return 0, err
+		}
+		return int64(purchaseTime.Hour()), nil
+	}
+	return 0, errors.New("unknown composite rule field " + strconv.Quote(field))
+}
+
+// compare applies a condition operator to a field value
+func compare(value int64, op string, target int64) (bool, error) {
+	switch op {
+	case "eq":
+		return value == target, nil
+	case "ne":
+		return value != target, nil
+	case "lt":
+		return value < target, nil
+	case "lte":
+		return value <= target, nil
+	case "gt":
+		return value > target, nil
+	case "gte":
+		return value >= target, nil
+	case "multipleOf":
+		if target == 0 {
+			return false, nil
+		}
+		return value%target == 0, nil
+	}
+	return false, errors.New("unknown composite rule op " + strconv.Quote(op))
+}
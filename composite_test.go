@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompositeRulesRule(t *testing.T) {
+	config := defaultScoringConfig()
+	config.CompositeRules = []compositeRule{{
+		Name: "roundDollarEvenItems",
+		Conditions: []ruleCondition{
+			{Field: "cents", Op: "eq", Value: 0},
+			{Field: "itemCount", Op: "multipleOf", Value: 2},
+		},
+		Bonus: 15,
+	}}
+	twoItems := []item{{ShortDescription: "A", Price: "1.00"}, {ShortDescription: "B", Price: "1.00"}}
+
+	tests := []struct {
+		name   string
+		r      receipt
+		points int
+	}{
+		{"all conditions hold", receipt{Total: "2.00", Items: twoItems}, 15},
+		{"total has cents", receipt{Total: "2.50", Items: twoItems}, 0},
+		{"odd item count", receipt{Total: "1.00", Items: twoItems[:1]}, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			points, err := compositeRulesRule(&test.r, config, nil)
+			if err != nil || points != test.points {
+				t.Errorf("compositeRulesRule = %d, %v, want %d", points, err, test.points)
+			}
+		})
+	}
+}
+
+func TestCompositeRulesOffByDefault(t *testing.T) {
+	r := &receipt{Total: "2.00", Items: []item{{ShortDescription: "A", Price: "1.00"}, {ShortDescription: "B", Price: "1.00"}}}
+	if points, err := compositeRulesRule(r, defaultScoringConfig(), nil); err != nil || points != 0 {
+		t.Errorf("default config awarded %d composite points (%v), want 0", points, err)
+	}
+}
+
+func TestCompositeRuleHourWithoutTime(t *testing.T) {
+	resetState(t)
+	appSettings.LenientParsing = true
+	config := defaultScoringConfig()
+	config.CompositeRules = []compositeRule{{
+		Name:       "morning",
+		Conditions: []ruleCondition{{Field: "hour", Op: "lt", Value: 12}},
+		Bonus:      10,
+	}}
+
+	r := &receipt{PurchaseDate: "2022-01-01", Total: "1.00"}
+	if points, err := compositeRulesRule(r, config, nil); err != nil || points != 0 {
+		t.Errorf("receipt without a purchase time = %d, %v, want 0 and no error", points, err)
+	}
+	r.PurchaseTime = "09:00"
+	if points, err := compositeRulesRule(r, config, nil); err != nil || points != 10 {
+		t.Errorf("morning receipt = %d, %v, want 10", points, err)
+	}
+}
+
+func TestCompositeRuleConfigValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition string
+		valid     bool
+	}{
+		{"known field and op", `{"field": "hour", "op": "gte", "value": 14}`, true},
+		{"unknown field", `{"field": "hours", "op": "gte", "value": 14}`, false},
+		{"unknown op", `{"field": "hour", "op": ">=", "value": 14}`, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body := `{"compositeRules": [{"name": "rule", "bonus": 5, "conditions": [` + test.condition + `]}]}`
+
+			path := filepath.Join(t.TempDir(), "scoring.json")
+			if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := loadScoringConfig(path); (err == nil) != test.valid {
+				t.Errorf("loadScoringConfig = %v, want valid %t", err, test.valid)
+			}
+
+			resetState(t)
+			appSettings.DevMode = true
+			id := processTestReceipt(t, targetReceipt)
+			status := http.StatusOK
+			if !test.valid {
+				status = http.StatusBadRequest
+			}
+			for _, recorder := range []*httptest.ResponseRecorder{
+				doRequest(t, http.MethodPost, "/receipts/"+id+"/score-with", body),
+				doRequest(t, http.MethodPost, "/receipts/simulate-config", body),
+				doRequest(t, http.MethodGet, "/receipts/"+id+"/points", "", "X-Scoring-Config", encodedConfig(body)),
+			} {
+				if recorder.Code != status {
+					t.Errorf("returned %d, want %d: %s", recorder.Code, status, recorder.Body.String())
+				}
+			}
+		})
+	}
+}
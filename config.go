@@ -0,0 +1,349 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// settings holds the server-wide options read from the environment at startup
+type settings struct {
+	DevMode           bool   // DEV_MODE enables development-only endpoints
+	DeterministicIDs  bool   // DETERMINISTIC_IDS assigns sequential receipt IDs (only honored in DEV_MODE)
+	ContentIDs        bool   // CONTENT_IDS derives receipt IDs from a hash of the receipt content
+	ScoringConfigFile string // SCORING_CONFIG is an optional path to a JSON scoring config
+
+	RejectFutureDates bool           // REJECT_FUTURE_DATES rejects receipts purchased after the current date
+	Timezone          *time.Location // TIMEZONE is the zone used to determine the current date (UTC by default)
+
+	// ProgramTimezone (PROGRAM_TIMEZONE) is the zone the date/time rules judge a purchase in, after reading the
+	// receipt's date and time as ReceiptTimezone (RECEIPT_TIMEZONE, UTC by default). When unset, the receipt's
+	// literal date and time are used as-is.
+	ProgramTimezone *time.Location
+	ReceiptTimezone *time.Location
+
+	StoreRawBody     bool // STORE_RAW_BODY keeps each submitted request body for GET /receipts/:id/raw
+	ResponseEnvelope bool // RESPONSE_ENVELOPE wraps successful responses as {"data": ..., "meta": ...}
+	ProblemJSON      bool // PROBLEM_JSON renders every error as RFC 7807 application/problem+json
+	ProcessCreated   bool // PROCESS_CREATED responds to POST /receipts/process with 201 Created instead of 200
+
+	RetailerCaseFold bool // RETAILER_CASE_FOLD merges retailer names that differ only by case in GET /retailers
+
+	Locale string // LOCALE selects how totals are formatted for display, e.g. "en-US" (default) or "de-DE"
+
+	PointsMaxAge time.Duration // POINTS_MAX_AGE is the Cache-Control max-age for computed points (0 sends no-store)
+
+	MinRetailerLength int // MIN_RETAILER_LENGTH rejects shorter retailer names, counted in characters (0 disables the check)
+	MaxTotalCents     int // MAX_TOTAL_CENTS rejects totals above it, in cents (0 disables the check)
+	MaxNoteLength     int // MAX_NOTE_LENGTH rejects longer notes, counted in characters (0 disables the check)
+	MaxItemPriceCents int // MAX_ITEM_PRICE_CENTS rejects items priced above it, in cents (0 disables the check)
+
+	AuditLog string // AUDIT_LOG is "stdout" or a file path to append create/update/delete audit entries to
+
+	AsyncScoring   bool // ASYNC_SCORING answers POST /receipts/process with 202 and scores receipts in the background
+	ScoringWorkers int  // SCORING_WORKERS is the number of background scoring goroutines
+
+	SoftDelete bool // SOFT_DELETE marks deleted receipts with deletedAt instead of removing them
+
+	// RequestTimeout (REQUEST_TIMEOUT) bounds how long a handler may work on a request; RouteTimeouts
+	// (ROUTE_TIMEOUTS, e.g. "POST /receipts/recalculate-all=5m,GET /receipts/:id/points=2s") overrides it
+	// per route, keyed by method and route pattern. A timeout of 0 means no limit.
+	RequestTimeout time.Duration
+	RouteTimeouts  map[string]time.Duration
+
+	DuplicateWindow time.Duration // DUPLICATE_WINDOW merges repeat submissions of a receipt within it (0 disables)
+
+	AllowDefaultTenant bool // ALLOW_DEFAULT_TENANT lets requests without X-Tenant-Id use the default tenant
+
+	MaxBatchSize int // MAX_BATCH_SIZE caps the number of receipts in a bulk request (0 means unlimited)
+
+	MaxInFlight int // MAX_IN_FLIGHT caps concurrent requests, answering extras with 503 (0 means unlimited)
+
+	ReadTimeout  time.Duration // READ_TIMEOUT bounds reading an entire request, including the body
+	WriteTimeout time.Duration // WRITE_TIMEOUT bounds writing a response
+	IdleTimeout  time.Duration // IDLE_TIMEOUT bounds how long keep-alive connections wait for the next request
+
+	TLSCertFile string // TLS_CERT_FILE is the certificate used to serve HTTPS (and HTTP/2)
+	TLSKeyFile  string // TLS_KEY_FILE is the private key matching TLS_CERT_FILE
+
+	// AMOUNT_FORMAT selects how totals and prices are checked: "any" accepts whatever parses (default),
+	// "exact" requires exactly two decimals, and "max2" accepts up to two decimals and normalizes to two
+	AmountFormat string
+
+	// WHOLE_DOLLAR_TOTALS selects how a total without a decimal point (e.g. "35") is handled:
+	// "allow" leaves it as submitted (default), "reject" fails validation, "normalize" treats it as "35.00"
+	WholeDollarTotals string
+
+	// CONTROL_CHARS selects how control characters in the retailer and item descriptions are handled:
+	// "allow" (default), "reject", or "strip"
+	ControlChars string
+
+	DateLayouts    []string // DATE_LAYOUTS is a comma-separated list of accepted purchaseDate layouts (ISO by default)
+	LenientParsing bool     // LENIENT_PARSING accepts dates and times missing leading zeros, e.g. 2024-3-7 and 9:05
+
+	// QUEUE_BACKEND enables the queue consumer with one of the registered queueBackends (unset disables it). It
+	// reads receipts from QUEUE_IN_SUBJECT, stores them under QUEUE_TENANT, and publishes points to QUEUE_OUT_SUBJECT.
+	QueueBackend    string
+	QueueInSubject  string
+	QueueOutSubject string
+	QueueTenant     string
+
+	// DESCRIPTION_PATTERN is the regular expression every item shortDescription must match,
+	// defaulting to the API spec's ^[\w\s\-]+$ (letters, digits, underscores, spaces and hyphens)
+	DescriptionPattern *regexp.Regexp
+
+	// DEFAULT_PURCHASE_TIME (e.g. 12:00) and DEFAULT_CURRENCY (e.g. USD) fill in a missing purchaseTime or
+	// currency in lenient mode, before validation and scoring; unset leaves the field missing
+	DefaultPurchaseTime string
+	DefaultCurrency     string
+}
+
+// specDescriptionPattern is the API spec's pattern for item short descriptions
+var specDescriptionPattern = regexp.MustCompile(`^[\w\s\-]+$`)
+
+// isoDateLayout is the spec's YYYY-MM-DD purchase date format
+const isoDateLayout = "2006-01-02"
+
+// defaultSettings returns the settings used when no environment variables are set
+func defaultSettings() settings {
+	return settings{
+		Timezone:           time.UTC,
+		DescriptionPattern: specDescriptionPattern,
+		QueueInSubject:     "receipts",
+		QueueOutSubject:    "points",
+		QueueTenant:        defaultTenant,
+		ReceiptTimezone:    time.UTC,
+		RetailerCaseFold:   true,
+		DateLayouts:        []string{isoDateLayout},
+		AmountFormat:       amountFormatAny,
+		ControlChars:       controlCharsAllow,
+		WholeDollarTotals:  wholeDollarAllow,
+		ReadTimeout:        10 * time.Second,
+		WriteTimeout:       30 * time.Second,
+		IdleTimeout:        120 * time.Second,
+		PointsMaxAge:       time.Minute,
+		RequestTimeout:     30 * time.Second,
+		MinRetailerLength:  1,
+		MaxTotalCents:      100000000,
+		MaxNoteLength:      500,
+		MaxBatchSize:       1000,
+		AllowDefaultTenant: true,
+		Locale:             "en-US",
+		ScoringWorkers:     4,
+	}
+}
+
+// loadSettings reads the server settings from environment variables
+func loadSettings() (settings, error) {
+	def := defaultSettings()
+	s := settings{
+		DevMode:            envBool("DEV_MODE", def.DevMode),
+		DeterministicIDs:   envBool("DETERMINISTIC_IDS", def.DeterministicIDs),
+		ContentIDs:         envBool("CONTENT_IDS", def.ContentIDs),
+		ScoringConfigFile:  os.Getenv("SCORING_CONFIG"),
+		RejectFutureDates:  envBool("REJECT_FUTURE_DATES", def.RejectFutureDates),
+		Timezone:           def.Timezone,
+		ReceiptTimezone:    def.ReceiptTimezone,
+		DescriptionPattern: def.DescriptionPattern,
+		QueueBackend:       os.Getenv("QUEUE_BACKEND"),
+		QueueInSubject:     envString("QUEUE_IN_SUBJECT", def.QueueInSubject),
+		QueueOutSubject:    envString("QUEUE_OUT_SUBJECT", def.QueueOutSubject),
+		QueueTenant:        envString("QUEUE_TENANT", def.QueueTenant),
+		ProcessCreated:     envBool("PROCESS_CREATED", def.ProcessCreated),
+		ProblemJSON:        envBool("PROBLEM_JSON", def.ProblemJSON),
+		ResponseEnvelope:   envBool("RESPONSE_ENVELOPE", def.ResponseEnvelope),
+		StoreRawBody:       envBool("STORE_RAW_BODY", def.StoreRawBody),
+		RetailerCaseFold:   envBool("RETAILER_CASE_FOLD", def.RetailerCaseFold),
+		MaxInFlight:        envInt("MAX_IN_FLIGHT", def.MaxInFlight),
+		MaxBatchSize:       envInt("MAX_BATCH_SIZE", def.MaxBatchSize),
+		AllowDefaultTenant: envBool("ALLOW_DEFAULT_TENANT", def.AllowDefaultTenant),
+		DuplicateWindow:    envDuration("DUPLICATE_WINDOW", def.DuplicateWindow),
+		RequestTimeout:     envDuration("REQUEST_TIMEOUT", def.RequestTimeout),
+		SoftDelete:         envBool("SOFT_DELETE", def.SoftDelete),
+		AsyncScoring:       envBool("ASYNC_SCORING", def.AsyncScoring),
+		ScoringWorkers:     envInt("SCORING_WORKERS", def.ScoringWorkers),
+		AuditLog:           os.Getenv("AUDIT_LOG"),
+		MaxTotalCents:      envInt("MAX_TOTAL_CENTS", def.MaxTotalCents),
+		MaxItemPriceCents:  envInt("MAX_ITEM_PRICE_CENTS", def.MaxItemPriceCents),
+		MaxNoteLength:      envInt("MAX_NOTE_LENGTH", def.MaxNoteLength),
+		MinRetailerLength:  envInt("MIN_RETAILER_LENGTH", def.MinRetailerLength),
+		PointsMaxAge:       envDuration("POINTS_MAX_AGE", def.PointsMaxAge),
+		ReadTimeout:        envDuration("READ_TIMEOUT", def.ReadTimeout),
+		WriteTimeout:       envDuration("WRITE_TIMEOUT", def.WriteTimeout),
+		IdleTimeout:        envDuration("IDLE_TIMEOUT", def.IdleTimeout),
+		TLSCertFile:        os.Getenv("TLS_CERT_FILE"),
+		TLSKeyFile:         os.Getenv("TLS_KEY_FILE"),
+		DateLayouts:        envList("DATE_LAYOUTS", def.DateLayouts),
+		LenientParsing:     envBool("LENIENT_PARSING", def.LenientParsing),
+		AmountFormat:       envString("AMOUNT_FORMAT", def.AmountFormat),
+		ControlChars:       envString("CONTROL_CHARS", def.ControlChars),
+		WholeDollarTotals:  envString("WHOLE_DOLLAR_TOTALS", def.WholeDollarTotals),
+		Locale:             envString("LOCALE", def.Locale),
+	}
+
+	switch s.AmountFormat {
+	case amountFormatAny, amountFormatExact, amountFormatMax2:
+	default:
+		return s, errors.New("AMOUNT_FORMAT must be one of any, exact, max2")
+	}
+	switch s.ControlChars {
+	case controlCharsAllow, controlCharsReject, controlCharsStrip:
+	default:
+		return s, errors.New("CONTROL_CHARS must be one of allow, reject, strip")
+	}
+	switch s.WholeDollarTotals {
+	case wholeDollarAllow, wholeDollarReject, wholeDollarNormalize:
+	default:
+		return s, errors.New("WHOLE_DOLLAR_TOTALS must be one of allow, reject, normalize")
+	}
+
+	if _, ok := queueBackends[s.QueueBackend]; s.QueueBackend != "" && !ok {
+		return s, errors.New("QUEUE_BACKEND " + strconv.Quote(s.QueueBackend) + " is not a supported queue backend")
+	}
+	if !tenantIDPattern.MatchString(s.QueueTenant) {
+		return s, errors.New("QUEUE_TENANT must be 1-64 letters, digits, '-' or '_'")
+	}
+
+	if _, ok := localeFormats[s.Locale]; !ok {
+		return s, errors.New("LOCALE must be one of de-DE, en-GB, en-US, es-ES, fr-FR")
+	}
+
+	if value := os.Getenv("DESCRIPTION_PATTERN"); value != "" {
+		pattern, err := regexp.Compile(value)
+		if err != nil {
+			return s, errors.New("DESCRIPTION_PATTERN is not a valid regular expression: " + err.Error())
+		}
+		s.DescriptionPattern = pattern
+	}
+	if value := os.Getenv("DEFAULT_PURCHASE_TIME"); value != "" {
+		if _, err := time.Parse("15:04", value); err != nil {
+			return s, errors.New("DEFAULT_PURCHASE_TIME must be in HH:MM format")
+		}
+		s.DefaultPurchaseTime = value
+	}
+	if value := os.Getenv("DEFAULT_CURRENCY"); value != "" {
+		if !currencyPattern.MatchString(value) {
+			return s, errors.New("DEFAULT_CURRENCY must be a 3-letter ISO 4217 code, e.g. USD")
+		}
+		s.DefaultCurrency = value
+	}
+
+	routeTimeouts, err := parseRouteTimeouts(envList("ROUTE_TIMEOUTS", nil))
+	if err != nil {
+		return s, err
+	}
+	s.RouteTimeouts = routeTimeouts
+
+	if name := os.Getenv("TIMEZONE"); name != "" {
+		location, err := time.LoadLocation(name)
+		if err != nil {
+			return s, err
+		}
+		s.Timezone = location
+	}
+	if name := os.Getenv("PROGRAM_TIMEZONE"); name != "" {
+		location, err := time.LoadLocation(name)
+		if err != nil {
+			return s, err
+		}
+		s.ProgramTimezone = location
+	}
+	if name := os.Getenv("RECEIPT_TIMEZONE"); name != "" {
+		location, err := time.LoadLocation(name)
+		if err != nil {
+			return s, err
+		}
+		s.ReceiptTimezone = location
+	}
+
+	return s, nil
+}
+
+// loadScoringConfig returns the default scoring config, overridden by any values in the given JSON file
+func loadScoringConfig(path string) (ScoringConfig, error) {
+	config := defaultScoringConfig()
+	if path == "" {
+		return config, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+// envBool reads a boolean environment variable, falling back to def when unset or unparsable
+func envBool(key string, def bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// envInt reads an integer environment variable, falling back to def when unset or unparsable
+func envInt(key string, def int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// envDuration reads a duration environment variable such as "15s", falling back to def when unset or unparsable
+func envDuration(key string, def time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// envString reads a string environment variable, falling back to def when unset
+func envString(key string, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return def
+}
+
+// parseRouteTimeouts parses "METHOD /route=duration" entries into a map keyed by "METHOD /route"
+func parseRouteTimeouts(entries []string) (map[string]time.Duration, error) {
+	timeouts := map[string]time.Duration{}
+	for _, entry := range entries {
+		i := strings.LastIndex(entry, "=")
+		if i < 0 {
+			return nil, errors.New("ROUTE_TIMEOUTS entries must look like \"GET /receipts/:id/points=2s\"")
+		}
+		timeout, err := time.ParseDuration(strings.TrimSpace(entry[i+1:]))
+		if err != nil {
+			return nil, errors.New("ROUTE_TIMEOUTS has an invalid duration for " + strings.TrimSpace(entry[:i]))
+		}
+		timeouts[strings.Join(strings.Fields(entry[:i]), " ")] = timeout
+	}
+	return timeouts, nil
+}
+
+// envList reads a comma-separated environment variable, falling back to def when unset
+func envList(key string, def []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+
+	list := []string{}
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestServerTimeouts(t *testing.T) {
+	t.Setenv("READ_TIMEOUT", "3s")
+	t.Setenv("WRITE_TIMEOUT", "4s")
+	t.Setenv("IDLE_TIMEOUT", "5s")
+	settings, err := loadSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := newServer(http.NotFoundHandler(), settings)
+	if server.ReadTimeout != 3*time.Second || server.WriteTimeout != 4*time.Second || server.IdleTimeout != 5*time.Second {
+		t.Errorf("timeouts = %v/%v/%v, want 3s/4s/5s", server.ReadTimeout, server.WriteTimeout, server.IdleTimeout)
+	}
+}
+
+func TestServerTimeoutDefaults(t *testing.T) {
+	server := newServer(http.NotFoundHandler(), defaultSettings())
+	if server.ReadTimeout <= 0 || server.WriteTimeout <= 0 || server.IdleTimeout <= 0 {
+		t.Errorf("default timeouts = %v/%v/%v, want all set", server.ReadTimeout, server.WriteTimeout, server.IdleTimeout)
+	}
+}
+
+func TestServerWriteTimeoutCoversRouteTimeouts(t *testing.T) {
+	t.Setenv("ROUTE_TIMEOUTS", "POST /receipts/recalculate-all=5m,GET /receipts/:id/points=2s")
+	settings, err := loadSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := newServer(http.NotFoundHandler(), settings)
+	if want := 5*time.Minute + routeTimeoutWriteMargin; server.WriteTimeout != want {
+		t.Errorf("write timeout = %v, want %v", server.WriteTimeout, want)
+	}
+}
+
+func TestRouteTimeouts(t *testing.T) {
+	t.Setenv("ROUTE_TIMEOUTS", "POST  /receipts/recalculate-all = 5m, GET /receipts/:id/points=2s")
+	settings, err := loadSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]time.Duration{
+		"POST /receipts/recalculate-all": 5 * time.Minute,
+		"GET /receipts/:id/points":       2 * time.Second,
+	}
+	if !reflect.DeepEqual(settings.RouteTimeouts, want) {
+		t.Errorf("route timeouts = %v, want %v", settings.RouteTimeouts, want)
+	}
+
+	for _, value := range []string{"GET /receipts", "GET /receipts=soon"} {
+		t.Setenv("ROUTE_TIMEOUTS", value)
+		if _, err := loadSettings(); err == nil {
+			t.Errorf("accepted ROUTE_TIMEOUTS %q", value)
+		}
+	}
+}
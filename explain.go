@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ruleExplanations describe why a rule or adjustment contributed to a receipt's points, as the phrase
+// following "N points" in a points explanation. Rules without an entry are explained by name.
+var ruleExplanations = map[string]func(r *receipt) string{
+	"retailerName": func(r *receipt) string {
+		return fmt.Sprintf("from retailer name (%d alphanumeric chars)", alphanumericCount(r.Retailer))
+	},
+	"evenRetailerName": func(r *receipt) string { return "for even-length retailer name" },
+	"roundDollar":      func(r *receipt) string { return "for round-dollar total" },
+	"quarterMultiple":  func(r *receipt) string { return "for total that is a multiple of 0.25" },
+	"itemPairs": func(r *receipt) string {
+		if pairs := len(r.Items) / 2; pairs != 1 {
+			return fmt.Sprintf("for %d items (%d pairs)", len(r.Items), pairs)
+		}
+		return fmt.Sprintf("for %d items (1 pair)", len(r.Items))
+	},
+	"itemDescription":    func(r *receipt) string { return "for item descriptions with a length that is a multiple of 3" },
+	"oddDay":             func(r *receipt) string { return "for odd purchase day" },
+	"afternoon":          func(r *receipt) string { return "for purchase between 2:00pm and 4:00pm" },
+	"topOfHour":          func(r *receipt) string { return "for purchase on the hour" },
+	"itemCategory":       func(r *receipt) string { return "from item category bonuses" },
+	"itemKeyword":        func(r *receipt) string { return "from item keyword bonuses" },
+	"uniqueDescriptions": func(r *receipt) string { return "for unique item descriptions" },
+	"largePurchase":      func(r *receipt) string { return "for large purchase" },
+	"centsModulus":       func(r *receipt) string { return "for cents matching the configured modulus" },
+	"logTotal":           func(r *receipt) string { return "for the log of the total" },
+	"pointsPerDollar":    func(r *receipt) string { return "for whole dollars spent" },
+	"totalDigits":        func(r *receipt) string { return "for digits in the total" },
+	"composite":          func(r *receipt) string { return "from composite rules" },
+	"weekend":            func(r *receipt) string { return "for weekend purchase" },
+	"promoWindow":        func(r *receipt) string { return "from promo windows" },
+	"oddItemCount":       func(r *receipt) string { return "for odd item count" },
+	"firstOfMonth":       func(r *receipt) string { return "for first receipt from the retailer this month" },
+	"premiumPurchase":    func(r *receipt) string { return "for premium purchase" },
+	"purchaseStreak":     func(r *receipt) string { return "for purchase streak" },
+
+	"retailerParticipation": func(r *receipt) string { return "for non-participating retailer" },
+	"minimumTotal":          func(r *receipt) string { return "for total below the minimum" },
+	"sameDayRepeat":         func(r *receipt) string { return "for repeat same-day receipt from the retailer" },
+	"ageDecay":              func(r *receipt) string { return "for receipt age" },
+	"missingTimePenalty":    func(r *receipt) string { return "for missing purchase time" },
+	"roundTotalPenalty":     func(r *receipt) string { return "for suspiciously round total" },
+	"retailerMultiplier":    func(r *receipt) string { return "from retailer multiplier" },
+	"finalRounding":         func(r *receipt) string { return "from final rounding" },
+	maxPointsAdjustmentName: func(r *receipt) string { return "from maximum points cap" },
+}
+
+// explainBreakdown writes a receipt's breakdown as plain English, e.g.
+// "6 points from retailer name (6 alphanumeric chars); 50 points for round-dollar total; 56 points total".
+// Rules that awarded nothing are left out.
+func explainBreakdown(r *receipt, breakdown []ruleContribution) string {
+	parts := []string{}
+	pointTotal := 0
+	for _, contribution := range breakdown {
+		pointTotal += contribution.Points
+		if contribution.Points == 0 {
+			continue
+		}
+
+		reason := "from " + contribution.Rule
+		if explain, ok := ruleExplanations[contribution.Rule]; ok {
+			reason = explain(r)
+		}
+		parts = append(parts, pluralPoints(contribution.Points)+" "+reason)
+	}
+	parts = append(parts, pluralPoints(pointTotal)+" total")
+	return strings.Join(parts, "; ")
+}
+
+// pluralPoints writes a point count with its unit, e.g. "1 point" or "-5 points"
+func pluralPoints(points int) string {
+	if points == 1 || points == -1 {
+		return fmt.Sprintf("%d point", points)
+	}
+	return fmt.Sprintf("%d points", points)
+}
+
+// explainPoints takes in a receipt ID and sends a plain-text explanation of how its points were calculated
+func explainPoints(context *gin.Context) {
+	receipt, err := getReceiptById(tenantStore(context), context.Param("id"))
+	if err != nil {
+		respondError(context, http.StatusNotFound, "No receipt found for that id", nil)
+		return
+	}
+
+	config, _ := requestScoringConfig(context)
+	breakdown, err := calculateBreakdown(receipt, config, tenantStore(context))
+	if err != nil {
+		respondError(context, http.StatusBadRequest, "Unable to calculate points ("+err.Error()+")", nil)
+		return
+	}
+	context.String(http.StatusOK, explainBreakdown(receipt, breakdown))
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestExplainPoints(t *testing.T) {
+	resetState(t)
+	id := processTestReceipt(t, cornerMarketReceipt)
+
+	recorder := doRequest(t, http.MethodGet, "/receipts/"+id+"/points/explain", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("explain returned %d: %s", recorder.Code, recorder.Body.String())
+	}
+	explanation := recorder.Body.String()
+	for _, phrase := range []string{
+		"14 points from retailer name (14 alphanumeric chars)",
+		"50 points for round-dollar total",
+		"25 points for total that is a multiple of 0.25",
+		"10 points for 4 items (2 pairs)",
+		"10 points for purchase between 2:00pm and 4:00pm",
+		"109 points total",
+	} {
+		if !strings.Contains(explanation, phrase) {
+			t.Errorf("explanation %q is missing %q", explanation, phrase)
+		}
+	}
+	// the purchase day is even, so the odd-day rule awarded nothing and isn't mentioned
+	if strings.Contains(explanation, "odd purchase day") {
+		t.Errorf("explanation %q mentions a rule that awarded nothing", explanation)
+	}
+
+	if recorder := doRequest(t, http.MethodGet, "/receipts/3f2504e0-4f89-41d3-9a0c-0305e82c3301/points/explain", ""); recorder.Code != http.StatusNotFound {
+		t.Errorf("explain for an unknown receipt returned %d, want 404", recorder.Code)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// receiptFilter narrows receipt listings by retailer (case-insensitive), an inclusive purchase date range,
+// and receipts created or updated after Since. Soft-deleted receipts are left out unless IncludeDeleted is set.
+type receiptFilter struct {
+	Retailer       string
+	StartDate      string
+	EndDate        string
+	Since          time.Time
+	IncludeDeleted bool
+}
+
+// parseReceiptFilter reads the retailer, startDate, endDate, since and includeDeleted query params
+// shared by the listing endpoints
+func parseReceiptFilter(context *gin.Context) (receiptFilter, error) {
+	filter := receiptFilter{
+		Retailer:       context.Query("retailer"),
+		StartDate:      context.Query("startDate"),
+		EndDate:        context.Query("endDate"),
+		IncludeDeleted: context.Query("includeDeleted") == "true",
+	}
+
+	for _, date := range []string{filter.StartDate, filter.EndDate} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse(isoDateLayout, date); err != nil {
+			return filter, errors.New("dates must be in YYYY-MM-DD format")
+		}
+	}
+
+	if since := context.Query("since"); since != "" {
+		sinceTime, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return filter, errors.New("since must be an RFC 3339 timestamp")
+		}
+		filter.Since = sinceTime
+	}
+
+	return filter, nil
+}
+
+// matches reports whether a receipt passes the filter
+func (f receiptFilter) matches(r receipt) bool {
+	if r.DeletedAt != nil && !f.IncludeDeleted {
+		return false
+	}
+	if f.Retailer != "" && !strings.EqualFold(f.Retailer, r.Retailer) {
+		return false
+	}
+	// ISO dates compare correctly as strings
+	purchaseDate := dateKey(r.PurchaseDate)
+	if f.StartDate != "" && purchaseDate < f.StartDate {
+		return false
+	}
+	if f.EndDate != "" && purchaseDate > f.EndDate {
+		return false
+	}
+	// UpdatedAt starts out equal to ProcessedAt, so it covers both creates and updates
+	if !f.Since.IsZero() && !r.UpdatedAt.After(f.Since) {
+		return false
+	}
+	return true
+}
+
+// dateKey normalizes a purchase date in any accepted layout to ISO YYYY-MM-DD,
+// returning it unchanged if it can't be parsed
+func dateKey(purchaseDate string) string {
+	date, err := parsePurchaseDate(purchaseDate, appSettings.DateLayouts)
+	if err != nil {
+		return purchaseDate
+	}
+	return date.Format(isoDateLayout)
+}
+
+// filteredReceipts returns the tenant's stored receipts matching the request's filter query params
+func filteredReceipts(context *gin.Context) ([]receipt, error) {
+	filter, err := parseReceiptFilter(context)
+	if err != nil {
+		return nil, err
+	}
+
+	// use the purchase date index to avoid a full scan when a date range is given
+	scoped := tenantStore(context)
+	var candidates []receipt
+	if filter.StartDate != "" || filter.EndDate != "" {
+		candidates = scoped.listByIDs(scoped.idsByDateRange(filter.StartDate, filter.EndDate))
+	} else {
+		candidates = scoped.list()
+	}
+
+	filtered := []receipt{}
+	for _, r := range candidates {
+		if filter.matches(r) {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered, nil
+}
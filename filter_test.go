@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetReceiptsSince(t *testing.T) {
+	resetState(t)
+	cutoff := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	fixedNow(t, cutoff.Add(-time.Hour))
+	before := processTestReceipt(t, targetReceipt)
+	updated := processTestReceipt(t, cornerMarketReceipt)
+	fixedNow(t, cutoff.Add(time.Hour))
+	after := processTestReceipt(t, targetReceipt)
+	if recorder := doRequest(t, http.MethodPut, "/receipts/"+updated, cornerMarketReceipt); recorder.Code != http.StatusOK {
+		t.Fatalf("update returned %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	tests := []struct {
+		name  string
+		since time.Time
+		ids   map[string]bool
+	}{
+		{"before everything", cutoff.Add(-2 * time.Hour), map[string]bool{before: true, updated: true, after: true}},
+		{"at the cutoff", cutoff, map[string]bool{updated: true, after: true}},
+		{"after everything", cutoff.Add(2 * time.Hour), map[string]bool{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := doRequest(t, http.MethodGet, "/receipts?since="+url.QueryEscape(test.since.Format(time.RFC3339)), "")
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("listing returned %d: %s", recorder.Code, recorder.Body.String())
+			}
+			var listed []receipt
+			decodeBody(t, recorder, &listed)
+			ids := map[string]bool{}
+			for _, r := range listed {
+				ids[r.ID] = true
+			}
+			if !reflect.DeepEqual(ids, test.ids) {
+				t.Errorf("listed %v, want %v", ids, test.ids)
+			}
+		})
+	}
+
+	if recorder := doRequest(t, http.MethodGet, "/receipts?since=yesterday", ""); recorder.Code != http.StatusBadRequest {
+		t.Errorf("invalid since returned %d, want 400", recorder.Code)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+)
+
+// IDGenerator produces the IDs assigned to newly processed receipts; r is the receipt being stored
+type IDGenerator interface {
+	New(r receipt) string
+}
+
+// idGenerator is the generator used by addReceipt; tests and dev mode can swap in a deterministic one
+var idGenerator IDGenerator = uuidGenerator{}
+
+// uuidGenerator is the default IDGenerator, producing random UUIDs
+type uuidGenerator struct{}
+
+// New returns a new random UUID
+func (uuidGenerator) New(r receipt) string {
+	return uuid.NewString()
+}
+
+// sequentialGenerator is a deterministic IDGenerator producing UUID-shaped IDs from a counter,
+// e.g. 00000000-0000-0000-0000-000000000001, so IDs are predictable in tests
+type sequentialGenerator struct {
+	counter atomic.Uint64
+}
+
+// New returns the next ID in the sequence
+func (g *sequentialGenerator) New(r receipt) string {
+	n := g.counter.Add(1)
+	return fmt.Sprintf("00000000-0000-0000-0000-%012d", n)
+}
+
+// contentGenerator is an IDGenerator deriving the ID from a SHA-256 hash of the receipt's content,
+// so identical receipts get the same ID and resubmitting one is idempotent
+type contentGenerator struct{}
+
+// receiptContent is the subset of a receipt hashed by contentGenerator
+type receiptContent struct {
+	Retailer     string `json:"retailer"`
+	PurchaseDate string `json:"purchaseDate"`
+	PurchaseTime string `json:"purchaseTime"`
+	Items        []item `json:"items"`
+	Total        string `json:"total"`
+	ExternalID   string `json:"externalId"`
+	Currency     string `json:"currency"`
+	Note         string `json:"note,omitempty"` // omitted when empty so receipts without a note keep their IDs
+}
+
+// New returns a UUID-shaped ID built from the first 16 bytes of the content hash
+func (contentGenerator) New(r receipt) string {
+	content, _ := json.Marshal(receiptContent{
+		Retailer:     r.Retailer,
+		PurchaseDate: r.PurchaseDate,
+		PurchaseTime: r.PurchaseTime,
+		Items:        r.Items,
+		Total:        r.Total,
+		ExternalID:   r.ExternalID,
+		Currency:     r.Currency,
+		Note:         r.Note,
+	})
+	sum := sha256.Sum256(content)
+
+	var id uuid.UUID
+	copy(id[:], sum[:16])
+	id[6] = id[6]&0x0f | 0x80 // version 8 (custom)
+	id[8] = id[8]&0x3f | 0x80 // RFC 4122 variant
+	return id.String()
+}
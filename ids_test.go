@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestSequentialIDs(t *testing.T) {
+	resetState(t)
+	idGenerator = &sequentialGenerator{}
+
+	for _, want := range []string{"00000000-0000-0000-0000-000000000001", "00000000-0000-0000-0000-000000000002"} {
+		if id := processTestReceipt(t, targetReceipt); id != want {
+			t.Errorf("id = %s, want %s", id, want)
+		}
+	}
+	if points := testPoints(t, "00000000-0000-0000-0000-000000000002"); points != 28 {
+		t.Errorf("points for the predicted id = %d, want 28", points)
+	}
+}
+
+func TestContentIDs(t *testing.T) {
+	base := receipt{Retailer: "Target", PurchaseDate: "2022-01-01", PurchaseTime: "13:01",
+		Items: []item{{ShortDescription: "Dew", Price: "1.00"}}, Total: "1.00"}
+	identical := base
+	identical.Items = []item{{ShortDescription: "Dew", Price: "1.00"}}
+	different := base
+	different.Total = "1.01"
+	noted := base
+	noted.Note = "refund pending"
+
+	generator := contentGenerator{}
+	if generator.New(base) != generator.New(identical) {
+		t.Error("identical content got different IDs")
+	}
+	if generator.New(base) == generator.New(different) {
+		t.Error("different content got the same ID")
+	}
+	if generator.New(base) == generator.New(noted) {
+		t.Error("receipts differing only by note got the same ID")
+	}
+	if _, err := uuid.Parse(generator.New(base)); err != nil {
+		t.Errorf("content ID isn't UUID-shaped: %v", err)
+	}
+}
+
+func TestContentIDResubmission(t *testing.T) {
+	resetState(t)
+	idGenerator = contentGenerator{}
+	audit := &bytes.Buffer{}
+	auditLog = audit
+
+	first := doRequest(t, http.MethodPost, "/receipts/process", targetReceipt)
+	again := doRequest(t, http.MethodPost, "/receipts/process", targetReceipt)
+	if first.Code != http.StatusOK || again.Code != http.StatusOK {
+		t.Fatalf("process returned %d then %d, want 200 both times", first.Code, again.Code)
+	}
+	var firstID, againID returnID
+	decodeBody(t, first, &firstID)
+	decodeBody(t, again, &againID)
+	if firstID.ID != againID.ID {
+		t.Errorf("resubmission got id %s, want %s", againID.ID, firstID.ID)
+	}
+	if count := len(store.list()); count != 1 {
+		t.Errorf("store holds %d receipts, want 1", count)
+	}
+	if entries := strings.Count(audit.String(), "\n"); entries != 1 {
+		t.Errorf("audit log has %d entries, want only the first create", entries)
+	}
+}
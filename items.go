@@ -0,0 +1,89 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// default and maximum page sizes for GET /items
+const (
+	defaultItemsLimit = 50
+	maxItemsLimit     = 1000
+)
+
+// returnItem represents one item flattened out of its receipt, with the points it earns on its own
+type returnItem struct {
+	ReceiptID        string `json:"receiptId"`
+	ShortDescription string `json:"shortDescription"`
+	Price            string `json:"price"`
+	Category         string `json:"category,omitempty"`
+	Points           int    `json:"points"`
+}
+
+// returnItems represents a page of items and the total number of items across all receipts
+type returnItems struct {
+	Items  []returnItem `json:"items"`
+	Total  int          `json:"total"`
+	Limit  int          `json:"limit"`
+	Offset int          `json:"offset"`
+}
+
+// itemPoints returns the points a single item earns from the per-item rules (description length, category
+// and keyword bonuses), skipping disabled rules. Unit prices that can't be parsed earn no description points.
+func itemPoints(it item, config ScoringConfig) int {
+	points := 0
+	if !config.DisabledRules["itemDescription"] {
+		if descriptionPoints, err := itemDescriptionPoints(it, config); err == nil {
+			points += int(math.Ceil(descriptionPoints))
+		}
+	}
+	if !config.DisabledRules["itemCategory"] && it.Category != "" {
+		points += config.CategoryBonuses[it.Category]
+	}
+	if !config.DisabledRules["itemKeyword"] {
+		// score the item on its own receipt so it earns exactly its share of the keyword rule
+		keywordPoints, _ := itemKeywordRule(&receipt{Items: []item{it}}, config, nil)
+		points += keywordPoints
+	}
+	return points
+}
+
+// getItems sends a page (?limit=, default 50, and ?offset=) of every item across the stored receipts,
+// in receipt insertion order, each with its parent receipt ID and per-item points
+func getItems(context *gin.Context) {
+	limit, err := strconv.Atoi(context.DefaultQuery("limit", strconv.Itoa(defaultItemsLimit)))
+	if err != nil || limit < 1 || limit > maxItemsLimit {
+		respondError(context, http.StatusBadRequest, "limit must be an integer from 1 to "+strconv.Itoa(maxItemsLimit), nil)
+		return
+	}
+	offset, err := strconv.Atoi(context.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		respondError(context, http.StatusBadRequest, "offset must be a non-negative integer", nil)
+		return
+	}
+
+	config, _ := requestScoringConfig(context)
+	page := returnItems{Items: []returnItem{}, Limit: limit, Offset: offset}
+	for _, r := range tenantStore(context).list() {
+		if r.DeletedAt != nil {
+			continue
+		}
+		for _, it := range r.Items {
+			if page.Total >= offset && len(page.Items) < limit {
+				page.Items = append(page.Items, returnItem{
+					ReceiptID:        r.ID,
+					ShortDescription: it.ShortDescription,
+					Price:            it.Price,
+					Category:         it.Category,
+					Points:           itemPoints(it, config),
+				})
+			}
+			page.Total++
+		}
+	}
+
+	respondJSON(context, http.StatusOK, page)
+}
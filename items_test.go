@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestGetItems(t *testing.T) {
+	resetState(t)
+	target := processTestReceipt(t, targetReceipt)
+	cornerMarket := processTestReceipt(t, cornerMarketReceipt)
+
+	tests := []struct {
+		name  string
+		query string
+		items []returnItem
+	}{
+		{"first page", "?limit=3", []returnItem{
+			{ReceiptID: target, ShortDescription: "Mountain Dew 12PK", Price: "6.49", Points: 0},
+			{ReceiptID: target, ShortDescription: "Emils Cheese Pizza", Price: "12.25", Points: 3},
+			{ReceiptID: target, ShortDescription: "Knorr Creamy Chicken", Price: "1.26", Points: 0},
+		}},
+		{"offset page across receipts", "?limit=3&offset=4", []returnItem{
+			{ReceiptID: target, ShortDescription: "   Klarbrunn 12-PK 12 FL OZ  ", Price: "12.00", Points: 3},
+			{ReceiptID: cornerMarket, ShortDescription: "Gatorade", Price: "2.25", Points: 0},
+			{ReceiptID: cornerMarket, ShortDescription: "Gatorade", Price: "2.25", Points: 0},
+		}},
+		{"past the end", "?offset=9", []returnItem{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := doRequest(t, http.MethodGet, "/items"+test.query, "")
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("items returned %d: %s", recorder.Code, recorder.Body.String())
+			}
+			var page returnItems
+			decodeBody(t, recorder, &page)
+			if page.Total != 9 {
+				t.Errorf("total = %d, want 9", page.Total)
+			}
+			if !reflect.DeepEqual(page.Items, test.items) {
+				t.Errorf("items = %+v, want %+v", page.Items, test.items)
+			}
+		})
+	}
+}
+
+func TestGetItemsRejectsBadPages(t *testing.T) {
+	resetState(t)
+	for _, query := range []string{"?limit=0", "?limit=1001", "?limit=ten", "?offset=-1"} {
+		if recorder := doRequest(t, http.MethodGet, "/items"+query, ""); recorder.Code != http.StatusBadRequest {
+			t.Errorf("items%s returned %d, want 400", query, recorder.Code)
+		}
+	}
+}
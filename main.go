@@ -1,21 +1,26 @@
 package main
 
 import (
+	"bytes"
+	ctxpkg "context"
+	"encoding/json"
 	"errors"
-	"math"
+	"io"
+	"log"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
-	"unicode"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 )
 
 // item represents one purchased item on the receipt with a short description and price
 type item struct {
 	ShortDescription string `json:"shortDescription"`
 	Price            string `json:"price"`
+	Category         string `json:"category,omitempty"`
 }
 
 // receipt represents a purchase receipt containing details of a transaction
@@ -25,8 +30,25 @@ type receipt struct {
 	PurchaseTime string `json:"purchaseTime"`
 	Items        []item `json:"items"`
 	Total        string `json:"total"`
+	ExternalID   string `json:"externalId,omitempty"`
+	Currency     string `json:"currency,omitempty"`
+	Note         string `json:"note,omitempty"` // free text from the client, not used in scoring
 	ID           string `json:"id"`
+	Version      int    `json:"version"`
 	Points       int    `json:"points"`
+
+	// SchemaVersion is the version the client declared; stored receipts are migrated to currentSchemaVersion
+	SchemaVersion int `json:"schemaVersion,omitempty"`
+
+	// set by the store when the receipt is first processed and each time it is replaced
+	ProcessedAt time.Time `json:"processedAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+
+	// DeletedAt marks a receipt deleted in SOFT_DELETE mode; deleted receipts are hidden unless asked for
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+
+	rawBody []byte // exactly what the client submitted, kept only when STORE_RAW_BODY is set
+	pending bool   // whether the receipt is queued for background scoring (ASYNC_SCORING)
 }
 
 // returnID represents an ID given to a processed receipt
@@ -39,149 +61,863 @@ type returnPoints struct {
 	Points int `json:"points"`
 }
 
-// receipts is an array containing all currently processed receipts
-// array is cleared at the end of each run //RKS not sure if this is necessary
-var receipts = []receipt{}
+// store holds all currently processed receipts
+// store is cleared at the end of each run //RKS not sure if this is necessary
+var store = newReceiptStore()
 
-// getReceipts sends a JSON response containing a list of all processed receipts (used for testing)
+// appSettings holds the server settings loaded at startup
+var appSettings = defaultSettings()
+
+// scoringConfig is the active config used to calculate receipt points
+var scoringConfig = defaultScoringConfig()
+
+// getReceipts sends a JSON response containing a list of all processed receipts (used for testing).
+// With ?withPoints=true, points are calculated (and cached) for any receipt that lacks them.
 func getReceipts(context *gin.Context) {
-	context.IndentedJSON(http.StatusOK, receipts)
+	receipts, err := filteredReceipts(context)
+	if err != nil {
+		respondError(context, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	if context.Query("withPoints") == "true" {
+		for i := range receipts {
+			// scoring every receipt can take a while, so stop if the client goes away
+			if err := context.Request.Context().Err(); err != nil {
+				respondError(context, http.StatusServiceUnavailable, "Listing cancelled", nil)
+				return
+			}
+			// receipts that can't be scored are listed with 0 points
+			receipts[i].Points, _ = requestPoints(context, &receipts[i])
+		}
+	}
+
+	if context.Query("format") == "ndjson" {
+		streamNDJSON(context, receipts)
+		return
+	}
+	respondJSON(context, http.StatusOK, receipts)
+}
+
+// streamNDJSON writes one receipt JSON object per line, flushing after each so large exports stream to the client
+func streamNDJSON(context *gin.Context, receipts []receipt) {
+	context.Header("Content-Type", "application/x-ndjson")
+	context.Status(http.StatusOK)
+
+	encoder := json.NewEncoder(context.Writer)
+	for _, r := range receipts {
+		if err := encoder.Encode(r); err != nil {
+			return
+		}
+		context.Writer.Flush()
+	}
+}
+
+// returnCount represents the number of stored receipts matching a listing filter
+type returnCount struct {
+	Count int `json:"count"`
+}
+
+// getReceiptCount sends the number of processed receipts, honoring the same filters as getReceipts
+func getReceiptCount(context *gin.Context) {
+	receipts, err := filteredReceipts(context)
+	if err != nil {
+		respondError(context, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	respondJSON(context, http.StatusOK, returnCount{Count: len(receipts)})
+}
+
+// returnIDs represents the IDs of the stored receipts matching a listing filter
+type returnIDs struct {
+	IDs []string `json:"ids"`
+}
+
+// getReceiptIds sends just the IDs of the processed receipts, honoring the same filters as getReceipts
+func getReceiptIds(context *gin.Context) {
+	receipts, err := filteredReceipts(context)
+	if err != nil {
+		respondError(context, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	ids := make([]string, 0, len(receipts))
+	for _, r := range receipts {
+		ids = append(ids, r.ID)
+	}
+	respondJSON(context, http.StatusOK, returnIDs{IDs: ids})
 }
 
 // processReceipt takes in a JSON receipt and returns a JSON object containing the generated ID for the receipt.
 func processReceipt(context *gin.Context) {
+	newReceipt, ok := decodeReceipt(context)
+	if !ok {
+		return
+	}
+
+	// if valid, add receipt to the store and return the assigned ID
+	newReceipt.pending = appSettings.AsyncScoring
+	id, merged := addOrMergeReceipt(tenantWriteStore(context), newReceipt)
+	returnID := returnID{
+		ID: id,
+	}
+	if merged {
+		// a likely double submission, or an identical resubmission; hand back the receipt already stored
+		context.Header("Location", "/receipts/"+returnID.ID+"/points")
+		respondJSON(context, http.StatusOK, returnID)
+		return
+	}
+	recordAudit(context, auditCreate, returnID.ID)
+
+	// point the client at the new receipt's points resource
+	context.Header("Location", "/receipts/"+returnID.ID+"/points")
+	status := http.StatusOK
+	if appSettings.ProcessCreated {
+		status = http.StatusCreated
+	}
+	if appSettings.AsyncScoring {
+		enqueueScoring(tenantStore(context), returnID.ID)
+		status = http.StatusAccepted
+	}
+	respondJSON(context, status, returnID)
+}
+
+// decodeReceipt reads and validates a JSON receipt from the request body.
+// On failure it writes the 400 response and returns false.
+func decodeReceipt(context *gin.Context) (receipt, bool) {
 	var newReceipt receipt
 
-	// generate and assign a unique ID to the receipt
-	newId := uuid.NewString()
-	newReceipt.ID = newId
+	// read the body up front so it can be checked for duplicate keys before binding
+	body, err := io.ReadAll(context.Request.Body)
+	if err != nil {
+		respondError(context, http.StatusBadRequest, "The receipt is invalid", nil)
+		return newReceipt, false
+	}
+	context.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	if key := findDuplicateKey(body); key != "" {
+		respondError(context, http.StatusBadRequest, "The receipt is invalid", gin.H{"error": "duplicate key " + strconv.Quote(key)})
+		return newReceipt, false
+	}
 
 	// check if new receipt is valid
-	if err := context.BindJSON(&newReceipt); err != nil {
-		context.IndentedJSON(http.StatusBadRequest, gin.H{"message": "The receipt is invalid"})
+	if err := context.ShouldBindJSON(&newReceipt); err != nil {
+		respondError(context, http.StatusBadRequest, "The receipt is invalid", bindErrorDetails(err))
+		return newReceipt, false
+	}
+	if appSettings.StoreRawBody {
+		newReceipt.rawBody = body
+	}
+
+	// upgrade older schema versions so the rest of the pipeline only sees the current one
+	version, err := declaredSchemaVersion(context.GetHeader("X-Receipt-Schema"), &newReceipt)
+	if err != nil {
+		respondError(context, http.StatusBadRequest, "The receipt is invalid", gin.H{"error": err.Error()})
+		return newReceipt, false
+	}
+	applyDefaults(&newReceipt, version, appSettings)
+	if err := migrateReceipt(&newReceipt, version); err != nil {
+		respondError(context, http.StatusBadRequest, "The receipt is invalid", gin.H{"error": err.Error()})
+		return newReceipt, false
+	}
+
+	if err := validateReceipt(&newReceipt, appSettings); err != nil {
+		respondError(context, http.StatusBadRequest, "The receipt is invalid", gin.H{"error": err.Error()})
+		return newReceipt, false
+	}
+
+	return newReceipt, true
+}
+
+// returnVersion represents the ID and current version of an updated receipt
+type returnVersion struct {
+	ID      string `json:"id"`
+	Version int    `json:"version"`
+}
+
+// updateReceipt replaces the contents of an existing receipt. If the request carries an If-Match header
+// with the receipt version the client last saw, the update is rejected with 409 when that version is stale.
+// If-Match: * matches any version, so the update only requires the receipt to exist.
+func updateReceipt(context *gin.Context) {
+	id := context.Param("id")
+
+	expectedVersion := 0 // 0 means the update is unconditional
+	if ifMatch := strings.TrimSpace(context.GetHeader("If-Match")); ifMatch != "" && ifMatch != "*" {
+		// accept the version as a strong or weak ETag, e.g. "2" or W/"2", or bare
+		version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`))
+		if err != nil || version < 1 {
+			respondError(context, http.StatusBadRequest, "If-Match must be a receipt version number", nil)
+			return
+		}
+		expectedVersion = version
+	}
+
+	updated, ok := decodeReceipt(context)
+	if !ok {
 		return
 	}
 
-	// if valid, add receipt to receipts array and return the assigned ID
-	receipts = append(receipts, newReceipt)
-	returnID := returnID{
-		ID: newId,
+	version, err := tenantStore(context).replace(id, updated, expectedVersion)
+	switch {
+	case errors.Is(err, errReceiptNotFound):
+		respondError(context, http.StatusNotFound, "No receipt found for that id", nil)
+		return
+	case errors.Is(err, errVersionConflict):
+		respondError(context, http.StatusConflict, "The receipt has been modified since that version", gin.H{"version": version})
+		return
+	}
+
+	recordAudit(context, auditUpdate, id)
+	context.Header("ETag", `"`+strconv.Itoa(version)+`"`)
+	respondJSON(context, http.StatusOK, returnVersion{ID: id, Version: version})
+}
+
+// deleteRequest is the body accepted by deleteReceipts
+type deleteRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// deleteResult reports which of the requested receipts were deleted and which weren't found
+type deleteResult struct {
+	Deleted  []string `json:"deleted"`
+	NotFound []string `json:"notFound"`
+}
+
+// deleteReceipts removes every listed receipt atomically and reports which were deleted vs. not found
+func deleteReceipts(context *gin.Context) {
+	var request deleteRequest
+	if err := context.ShouldBindJSON(&request); err != nil {
+		respondError(context, http.StatusBadRequest, "The request must be a JSON object with an ids array", nil)
+		return
+	}
+
+	scoped := tenantStore(context)
+	deleteMany := scoped.deleteMany
+	if appSettings.SoftDelete {
+		deleteMany = scoped.softDeleteMany
+	}
+	deleted, notFound := deleteMany(request.IDs)
+	for _, id := range deleted {
+		recordAudit(context, auditDelete, id)
+	}
+	respondJSON(context, http.StatusOK, deleteResult{Deleted: deleted, NotFound: notFound})
+}
+
+// restoreReceipt undeletes a soft-deleted receipt
+func restoreReceipt(context *gin.Context) {
+	id := context.Param("id")
+
+	switch err := tenantStore(context).restore(id); {
+	case errors.Is(err, errReceiptNotFound):
+		respondError(context, http.StatusNotFound, "No receipt found for that id", nil)
+		return
+	case errors.Is(err, errNotDeleted):
+		respondError(context, http.StatusConflict, "The receipt is not deleted", nil)
+		return
+	}
+
+	recordAudit(context, auditRestore, id)
+	respondJSON(context, http.StatusOK, returnID{ID: id})
+}
+
+// bindErrorDetails describes why a receipt failed to bind,
+// including the offending field and byte offset when the JSON decoder reports them
+func bindErrorDetails(err error) gin.H {
+	response := gin.H{}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		response["error"] = syntaxErr.Error()
+		response["offset"] = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		response["error"] = "expected " + typeErr.Type.String() + " but got " + typeErr.Value
+		response["field"] = typeErr.Field
+		response["offset"] = typeErr.Offset
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		response["error"] = "unexpected end of JSON input"
+	default:
+		response["error"] = err.Error()
+	}
+
+	return response
+}
+
+// findDuplicateKey returns the first top-level key that appears more than once in a JSON object.
+// Malformed JSON is ignored here and left for ShouldBindJSON to report.
+func findDuplicateKey(body []byte) string {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return ""
+	}
+
+	seen := map[string]bool{}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+		key, ok := token.(string)
+		if !ok {
+			return ""
+		}
+		if seen[key] {
+			return key
+		}
+		seen[key] = true
+
+		// skip over the value, whatever its type
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return ""
+		}
+	}
+	return ""
+}
+
+// addReceipt generates and assigns a unique ID to the receipt, stores it in s, and returns the ID.
+// It is shared by every ingestion path (HTTP and queue) so receipts are stored the same way.
+// existing is set when nothing was stored because the receipt's content ID is already stored.
+func addReceipt(s *receiptStore, newReceipt receipt) (id string, existing bool) {
+	newReceipt.ID = idGenerator.New(newReceipt)
+	return newReceipt.ID, !s.add(newReceipt)
+}
+
+// addOrMergeReceipt stores a new receipt like addReceipt, unless DUPLICATE_WINDOW is set and a receipt with the
+// same retailer, date and total was processed within the window, in which case that receipt's ID is returned
+// with merged set. merged is also set when addReceipt finds the receipt already stored.
+func addOrMergeReceipt(s *receiptStore, newReceipt receipt) (string, bool) {
+	if appSettings.DuplicateWindow <= 0 {
+		return addReceipt(s, newReceipt)
 	}
-	context.IndentedJSON(http.StatusOK, returnID)
+	newReceipt.ID = idGenerator.New(newReceipt)
+	return s.addOrMerge(newReceipt, appSettings.DuplicateWindow)
 }
 
 // getPoints takes in a receipt ID and returns a JSON object containing the points awarded for that receipt
 func getPoints(context *gin.Context) {
 	// grab id and look for matching receipt
 	id := context.Param("id")
-	receipt, err := getReceiptById(id)
+	receipt, err := getReceiptById(tenantStore(context), id)
+	if err != nil {
+		respondError(context, http.StatusNotFound, "No receipt found for that id", nil)
+		return
+	}
+
+	respondWithPoints(context, receipt)
+}
+
+// getPointsByExternalId takes in a client-supplied external reference and returns the points for the matching receipt
+func getPointsByExternalId(context *gin.Context) {
+	receipt, ok := tenantStore(context).findByExternalID(context.Param("externalId"))
+	if !ok || receipt.DeletedAt != nil {
+		respondError(context, http.StatusNotFound, "No receipt found for that external id", nil)
+		return
+	}
+
+	respondWithPoints(context, &receipt)
+}
+
+// getLatestPoints returns the points for the most recently processed receipt
+func getLatestPoints(context *gin.Context) {
+	receipt, ok := tenantStore(context).latest()
+	if !ok {
+		respondError(context, http.StatusNotFound, "No receipts have been processed", nil)
+		return
+	}
+
+	respondWithPoints(context, &receipt)
+}
+
+// respondWithPoints calculates (or reuses the cached) points for a receipt and writes them as the response,
+// or a 202 while the receipt is still waiting on background scoring. With ?withTotal=true the receipt's
+// total is echoed back formatted for display.
+func respondWithPoints(context *gin.Context, receipt *receipt) {
+	context.Header("Vary", "X-Tenant-Id")
+	_, overridden := requestScoringConfig(context)
+	if receipt.pending && !overridden {
+		context.Header("Cache-Control", "no-store")
+		respondJSON(context, http.StatusAccepted, gin.H{"id": receipt.ID, "status": "pending"})
+		return
+	}
+
+	pointTotal, err := requestPoints(context, receipt)
 	if err != nil {
-		context.IndentedJSON(http.StatusNotFound, gin.H{"message": "No receipt found for that id"})
+		context.Header("Cache-Control", "no-store")
+		respondError(context, http.StatusBadRequest, "Unable to calculate points ("+err.Error()+")", nil)
+		return
+	}
+
+	// points change when the receipt is updated or rescored, so clients may only reuse them for PointsMaxAge,
+	// and only privately since they depend on the caller's tenant; overridden configs are never cached
+	cacheControl := "no-store"
+	if appSettings.PointsMaxAge > 0 && !overridden {
+		cacheControl = "private, max-age=" + strconv.Itoa(int(appSettings.PointsMaxAge.Seconds()))
+	}
+	context.Header("Cache-Control", cacheControl)
+
+	if context.Query("withTotal") == "true" {
+		respondJSON(context, http.StatusOK, returnPointsWithTotal{Points: pointTotal, Total: formattedTotal(receipt)})
 		return
 	}
+	respondJSON(context, http.StatusOK, returnPoints{Points: pointTotal})
+}
+
+// returnPointsWithTotal represents the points awarded for a receipt along with its total formatted for display
+type returnPointsWithTotal struct {
+	Points int    `json:"points"`
+	Total  string `json:"total"`
+}
+
+// formattedTotal formats a receipt's total in its currency per the configured LOCALE,
+// falling back to the total as submitted if it can't be parsed
+func formattedTotal(r *receipt) string {
+	cents, err := parseCents(r.Total)
+	if err != nil {
+		return r.Total
+	}
+	currency := r.Currency
+	if currency == "" {
+		currency = defaultCurrency
+	}
+	return formatMoney(cents, currency, localeFormats[appSettings.Locale])
+}
+
+// requestPoints returns a receipt's point total for the request: under the config from the X-Scoring-Config
+// header if there is one, without caching, and otherwise via pointsFor
+func requestPoints(context *gin.Context, receipt *receipt) (int, error) {
+	if config, overridden := requestScoringConfig(context); overridden {
+		return calculatePoints(receipt, config, tenantStore(context))
+	}
+	return pointsFor(tenantStore(context), receipt)
+}
+
+// pointsFor returns a receipt's point total, calculating and caching it on the receipt stored in s if needed
+func pointsFor(s *receiptStore, receipt *receipt) (int, error) {
+	// age decay changes the total from one day to the next, so a cached total can't be trusted
+	cacheable := scoringConfig.AgeDecayFactor <= 0
 
 	// return point total right away if it has already been calculated
-	if receipt.Points != 0 {
-		context.IndentedJSON(http.StatusOK, returnPoints{Points: receipt.Points})
+	if cacheable && receipt.Points != 0 {
+		return receipt.Points, nil
+	}
+
+	pointTotal, err := calculatePoints(receipt, scoringConfig, s)
+	if err != nil {
+		return 0, err
+	}
+	if !cacheable {
+		return pointTotal, nil
+	}
+
+	// save point total to the stored receipt
+	s.setPoints(receipt.ID, pointTotal)
+	receipt.Points = pointTotal
+	return pointTotal, nil
+}
+
+// returnFull represents a receipt together with its points and per-rule breakdown
+type returnFull struct {
+	Receipt   receipt            `json:"receipt"`
+	Points    int                `json:"points"`
+	Breakdown []ruleContribution `json:"breakdown"`
+	Capped    bool               `json:"capped"` // whether the total was reduced to the configured maximum
+}
+
+// getFull takes in a receipt ID and returns the receipt, its points, and the per-rule breakdown in one response
+func getFull(context *gin.Context) {
+	receipt, err := getReceiptById(tenantStore(context), context.Param("id"))
+	if err != nil {
+		respondError(context, http.StatusNotFound, "No receipt found for that id", nil)
 		return
 	}
 
-	pointTotal := 0 // running tally for receipt points
+	config, _ := requestScoringConfig(context)
+	breakdown, err := calculateBreakdown(receipt, config, tenantStore(context))
+	if err != nil {
+		respondError(context, http.StatusBadRequest, "Unable to calculate points ("+err.Error()+")", nil)
+		return
+	}
 
-	// add one point for every alphanumeric char in retailer name
-	for _, char := range receipt.Retailer {
-		if unicode.IsLetter(char) || unicode.IsDigit(char) {
-			pointTotal++
+	// the points are summed from the breakdown rather than read from the cache, so the two always agree
+	// even once history rules or age-based adjustments have changed the result since it was cached
+	full := returnFull{Receipt: *receipt, Breakdown: breakdown}
+	for _, contribution := range breakdown {
+		full.Points += contribution.Points
+		if contribution.Rule == maxPointsAdjustmentName {
+			full.Capped = true
 		}
 	}
+	full.Receipt.Points = full.Points
+	respondJSON(context, http.StatusOK, full)
+}
+
+// scoreWithConfig takes in a receipt ID and a ScoringConfig body and returns the points the receipt would earn
+// under that config, without caching them or changing the active config. Fields missing from the body
+// take their default values.
+func scoreWithConfig(context *gin.Context) {
+	receipt, err := getReceiptById(tenantStore(context), context.Param("id"))
+	if err != nil {
+		respondError(context, http.StatusNotFound, "No receipt found for that id", nil)
+		return
+	}
+
+	config := defaultScoringConfig()
+	if err := context.ShouldBindJSON(&config); err != nil {
+		respondError(context, http.StatusBadRequest, "The scoring config is invalid", bindErrorDetails(err))
+		return
+	}
+
+	pointTotal, err := calculatePoints(receipt, config, tenantStore(context))
+	if err != nil {
+		respondError(context, http.StatusBadRequest, "Unable to calculate points ("+err.Error()+")", nil)
+		return
+	}
+	respondJSON(context, http.StatusOK, returnPoints{Points: pointTotal})
+}
 
-	// parse receipt total
-	totalFloat, err := strconv.ParseFloat(receipt.Total, 64)
+// getRawReceipt takes in a receipt ID and returns the exact body the client submitted for it
+func getRawReceipt(context *gin.Context) {
+	receipt, err := getReceiptById(tenantStore(context), context.Param("id"))
 	if err != nil {
-		context.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Unable to calculate points (invalid total)"})
+		respondError(context, http.StatusNotFound, "No receipt found for that id", nil)
+		return
+	}
+	if receipt.rawBody == nil {
+		respondError(context, http.StatusNotFound, "No raw body was stored for that receipt", nil)
 		return
 	}
 
-	// add 50 points if the receipt total is a round dollar amount with no cents
-	if math.Mod(totalFloat, 1) == 0 {
-		pointTotal += 50
+	context.Data(http.StatusOK, "application/json", receipt.rawBody)
+}
+
+// returnTier represents the reward tier a receipt's points fall into
+type returnTier struct {
+	Points int    `json:"points"`
+	Tier   string `json:"tier"`
+}
+
+// getTier takes in a receipt ID and returns the reward tier for that receipt's points
+func getTier(context *gin.Context) {
+	receipt, err := getReceiptById(tenantStore(context), context.Param("id"))
+	if err != nil {
+		respondError(context, http.StatusNotFound, "No receipt found for that id", nil)
+		return
 	}
 
-	// add 25 points if the receipt total is a multiple of 0.25.
-	if math.Mod(totalFloat, .25) == 0 {
-		pointTotal += 25
+	pointTotal, err := requestPoints(context, receipt)
+	if err != nil {
+		respondError(context, http.StatusBadRequest, "Unable to calculate points ("+err.Error()+")", nil)
+		return
 	}
+	config, _ := requestScoringConfig(context)
+	respondJSON(context, http.StatusOK, returnTier{Points: pointTotal, Tier: tierFor(pointTotal, config)})
+}
+
+// recalculateBatchSize is the number of receipts rescored between cancellation checks in recalculateAll
+const recalculateBatchSize = 100
+
+// recalculateSummary reports the outcome of a bulk points recalculation
+type recalculateSummary struct {
+	Processed int `json:"processed"`
+	Errors    int `json:"errors"`
+}
 
-	// add 5 points for every two items on the receipt.
-	pointTotal += (len(receipt.Items) / 2) * 5
+// recalculateAll recomputes and caches the points for every stored receipt using the current scoring config.
+// Receipts are processed in batches and the run stops early if the request is cancelled.
+func recalculateAll(context *gin.Context) {
+	scoped := tenantStore(context)
+	ids := scoped.ids()
+	summary := recalculateSummary{}
+
+	for start := 0; start < len(ids); start += recalculateBatchSize {
+		if err := context.Request.Context().Err(); err != nil {
+			respondError(context, http.StatusServiceUnavailable, "Recalculation cancelled", gin.H{"processed": summary.Processed, "errors": summary.Errors})
+			return
+		}
 
-	// iterate through every item listed on the receipt
-	// if the trimmed length of the item description is a multiple of 3,
-	// multiply the price by 0.2 and round up to the nearest integer. Add that many points.
-	for _, item := range receipt.Items {
-		if len(strings.TrimSpace(item.ShortDescription))%3 == 0 {
+		end := start + recalculateBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
 
-			// parse price of item
-			priceFloat, err := strconv.ParseFloat(item.Price, 64)
+		// score outside the scoped lock since cross-receipt rules read from the scoped
+		for _, r := range scoped.listByIDs(ids[start:end]) {
+			pointTotal, err := calculatePoints(&r, scoringConfig, scoped)
 			if err != nil {
-				context.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Unable to calculate points (invalid item price(s))"})
-				return
+				// clear any stale cached total so getPoints reports the error
+				scoped.setPoints(r.ID, 0)
+				summary.Errors++
+				continue
 			}
+			scoped.setPoints(r.ID, pointTotal)
+			summary.Processed++
+		}
+	}
+
+	respondJSON(context, http.StatusOK, summary)
+}
+
+// rulesSummary reports the points each rule contributed, summed over all stored receipts
+type rulesSummary struct {
+	Rules    []ruleContribution `json:"rules"`
+	Receipts int                `json:"receipts"`
+	Errors   int                `json:"errors"`
+}
 
-			pointTotal += int(math.Ceil(priceFloat * .2))
+// getRulesSummary aggregates each scoring rule's contribution across every stored receipt, followed by
+// any adjustments that changed the totals, so the entries add up to the points the receipts earned.
+// Receipts that can't be scored are counted in errors and left out of the sums.
+func getRulesSummary(context *gin.Context) {
+	scoped := tenantStore(context)
+	config, _ := requestScoringConfig(context)
+	summary := rulesSummary{Rules: []ruleContribution{}}
+	totals := map[string]int{}
+
+	for _, r := range scoped.list() {
+		if r.DeletedAt != nil {
+			continue
+		}
+		breakdown, err := calculateBreakdown(&r, config, scoped)
+		if err != nil {
+			summary.Errors++
+			continue
 		}
+		for _, contribution := range breakdown {
+			totals[contribution.Rule] += contribution.Points
+		}
+		summary.Receipts++
 	}
 
-	// add 6 points if the day in the purchase date is odd.
-	dayInt, err := strconv.Atoi(receipt.PurchaseDate[8:10]) // parse day of purchase, chars 8&9 in YYYY-MM-DD format
-	if err != nil {
-		context.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Unable to calculate points (invalid date of purchase)"})
+	// report every enabled rule in pipeline order, even if it contributed nothing
+	for _, rule := range scoringRules {
+		if config.DisabledRules[rule.Name] {
+			continue
+		}
+		summary.Rules = append(summary.Rules, ruleContribution{Rule: rule.Name, Points: totals[rule.Name]})
+	}
+	// then the adjustments that changed any receipt's points, in the order they're applied
+	for _, adjustment := range pointsAdjustments {
+		if points := totals[adjustment.Name]; points != 0 {
+			summary.Rules = append(summary.Rules, ruleContribution{Rule: adjustment.Name, Points: points})
+		}
+	}
+
+	respondJSON(context, http.StatusOK, summary)
+}
+
+// getTopReceipts sends the n (default 10) highest-scoring receipts in descending order of points,
+// calculating points as needed. Ties keep insertion order and receipts that can't be scored are skipped.
+func getTopReceipts(context *gin.Context) {
+	n, err := strconv.Atoi(context.DefaultQuery("n", "10"))
+	if err != nil || n < 0 {
+		respondError(context, http.StatusBadRequest, "n must be a non-negative integer", nil)
 		return
 	}
 
-	if dayInt%2 == 1 {
-		pointTotal += 6
+	scoped := tenantStore(context)
+	scored := []receipt{}
+	for _, r := range scoped.list() {
+		if r.DeletedAt != nil {
+			continue
+		}
+		points, err := requestPoints(context, &r)
+		if err != nil {
+			continue
+		}
+		r.Points = points
+		scored = append(scored, r)
 	}
 
-	// add 10 points if the time of purchase is after 2:00pm (inclusive) and before 4:00pm (exclusive)
-	hourInt, err := strconv.Atoi(receipt.PurchaseTime[0:2]) // parse hour of purchase, chars 0&1 in HH:MM format
-	if err != nil {
-		context.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Unable to calculate points (invalid time of purchase)"})
-		return
+	sort.SliceStable(scored, func(i, j int) bool {
+		return scored[i].Points > scored[j].Points
+	})
+	if n < len(scored) {
+		scored = scored[:n]
 	}
+	respondJSON(context, http.StatusOK, scored)
+}
 
-	if hourInt == 14 || hourInt == 15 {
-		pointTotal += 10
+// returnScores maps every stored receipt ID to freshly computed points, or to the error that prevented scoring
+type returnScores struct {
+	Scores map[string]int    `json:"scores"`
+	Errors map[string]string `json:"errors"`
+}
+
+// getScores recomputes every stored receipt's points from scratch, ignoring and leaving untouched the cached
+// totals, so a harness can snapshot-compare scores before and after a scoring change
+func getScores(context *gin.Context) {
+	scoped := tenantStore(context)
+	config, _ := requestScoringConfig(context)
+	scores := returnScores{Scores: map[string]int{}, Errors: map[string]string{}}
+
+	for _, r := range scoped.list() {
+		if r.DeletedAt != nil {
+			continue
+		}
+		pointTotal, err := calculatePoints(&r, config, scoped)
+		if err != nil {
+			scores.Errors[r.ID] = err.Error()
+			continue
+		}
+		scores.Scores[r.ID] = pointTotal
 	}
 
-	// save point total to receipt struct and return
-	receipt.Points = pointTotal
-	context.IndentedJSON(http.StatusOK, returnPoints{Points: receipt.Points})
+	respondJSON(context, http.StatusOK, scores)
+}
+
+// receiptDelta compares a receipt's points under the active config and a simulated one
+type receiptDelta struct {
+	ID        string `json:"id"`
+	Current   int    `json:"current"`
+	Simulated int    `json:"simulated"`
+	Delta     int    `json:"delta"`
 }
 
-// getReceiptById is a helper function that takes in a string id and returns the corresponding receipt
-func getReceiptById(id string) (*receipt, error) {
-	for i, r := range receipts {
-		if r.ID == id {
-			return &receipts[i], nil
+// simulationResult reports the aggregate and per-receipt effect of a simulated scoring config
+type simulationResult struct {
+	CurrentTotal   int               `json:"currentTotal"`
+	SimulatedTotal int               `json:"simulatedTotal"`
+	Delta          int               `json:"delta"`
+	Receipts       []receiptDelta    `json:"receipts"`
+	Errors         map[string]string `json:"errors"`
+}
+
+// simulateConfig takes in a ScoringConfig body and scores every stored receipt under both it and the active
+// config, without caching anything, so the impact of a config change can be previewed. Fields missing from
+// the body take their default values. Receipts that fail under either config are reported in errors.
+func simulateConfig(context *gin.Context) {
+	config := defaultScoringConfig()
+	if err := context.ShouldBindJSON(&config); err != nil {
+		respondError(context, http.StatusBadRequest, "The scoring config is invalid", bindErrorDetails(err))
+		return
+	}
+
+	scoped := tenantStore(context)
+	result := simulationResult{Receipts: []receiptDelta{}, Errors: map[string]string{}}
+	ids := scoped.ids()
+	for start := 0; start < len(ids); start += recalculateBatchSize {
+		if err := context.Request.Context().Err(); err != nil {
+			respondError(context, http.StatusServiceUnavailable, "Simulation cancelled", nil)
+			return
+		}
+
+		end := start + recalculateBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		for _, r := range scoped.listByIDs(ids[start:end]) {
+			if r.DeletedAt != nil {
+				continue
+			}
+			current, err := calculatePoints(&r, scoringConfig, scoped)
+			if err != nil {
+				result.Errors[r.ID] = err.Error()
+				continue
+			}
+			simulated, err := calculatePoints(&r, config, scoped)
+			if err != nil {
+				result.Errors[r.ID] = err.Error()
+				continue
+			}
+
+			result.Receipts = append(result.Receipts, receiptDelta{ID: r.ID, Current: current, Simulated: simulated, Delta: simulated - current})
+			result.CurrentTotal += current
+			result.SimulatedTotal += simulated
 		}
 	}
+	result.Delta = result.SimulatedTotal - result.CurrentTotal
+
+	respondJSON(context, http.StatusOK, result)
+}
+
+// getReceiptById is a helper function that takes in a string id and returns the corresponding receipt from s
+func getReceiptById(s *receiptStore, id string) (*receipt, error) {
+	if r, ok := s.get(id); ok && r.DeletedAt == nil {
+		return &r, nil
+	}
 
 	// no match found, return error message
 	return nil, errors.New("no receipt found for that id")
 }
 
+// setupRouter creates a new Gin router with every endpoint and its corresponding handler function
+func setupRouter() *gin.Engine {
+	router := gin.Default()
+	router.Use(assignRequestID, limitConcurrency(appSettings.MaxInFlight), requestTimeout(appSettings.RequestTimeout, appSettings.RouteTimeouts))
+
+	// receipt data is partitioned by tenant
+	tenantRoutes := router.Group("", scopeTenant, overrideScoringConfig)
+	tenantRoutes.GET("/receipts", getReceipts)
+	tenantRoutes.GET("/receipts/count", getReceiptCount)
+	tenantRoutes.GET("/receipts/ids", getReceiptIds)
+	tenantRoutes.GET("/receipts/top", getTopReceipts)
+	tenantRoutes.GET("/receipts/rules-summary", getRulesSummary)
+	tenantRoutes.GET("/receipts/latest/points", getLatestPoints)
+	tenantRoutes.POST("/receipts/process", processReceipt)
+	tenantRoutes.POST("/receipts/process/raw", processRawReceipt)
+	tenantRoutes.POST("/receipts/delete", deleteReceipts)
+	tenantRoutes.POST("/receipts/simulate-config", simulateConfig)
+	tenantRoutes.POST("/receipts/validate/batch", validateBatch)
+	tenantRoutes.PUT("/receipts/:id", validateID, updateReceipt)
+	tenantRoutes.POST("/receipts/:id/restore", validateID, restoreReceipt)
+	tenantRoutes.GET("/receipts/:id/points", validateID, getPoints)
+	tenantRoutes.GET("/receipts/:id/tier", validateID, getTier)
+	tenantRoutes.GET("/receipts/:id/full", validateID, getFull)
+	tenantRoutes.GET("/receipts/:id/points/explain", validateID, explainPoints)
+	tenantRoutes.GET("/receipts/:id/printable", validateID, getPrintable)
+	tenantRoutes.POST("/receipts/:id/score-with", validateID, scoreWithConfig)
+	tenantRoutes.GET("/receipts/:id/raw", devOnly, validateID, getRawReceipt)
+	tenantRoutes.GET("/receipts/by-external/:externalId/points", getPointsByExternalId)
+	tenantRoutes.POST("/receipts/recalculate-all", devOnly, recalculateAll)
+	tenantRoutes.GET("/receipts/scores", devOnly, getScores)
+	tenantRoutes.GET("/retailers", getRetailers)
+	tenantRoutes.GET("/retailers/:name/points", getRetailerPoints)
+	tenantRoutes.GET("/items", getItems)
+
+	router.GET("/validators", getValidators)
+	router.GET("/status", getStatus)
+	router.GET("/version", getVersion)
+
+	return router
+}
+
 // main is the entry point of the Gin web application.
-// It sets up the router, defines the endpoints, and starts the server.
+// It loads the config, sets up the router, and starts the server.
 func main() {
-	// create a new Gin router
-	router := gin.Default()
+	startTime = now()
 
-	// define endpoints and their corresponding handler functions.
-	router.GET("/receipts", getReceipts)
-	router.POST("/receipts/process", processReceipt)
-	router.GET("/receipts/:id/points", getPoints)
+	// load settings and the scoring config
+	var err error
+	appSettings, err = loadSettings()
+	if err != nil {
+		log.Fatalf("unable to load settings: %v", err)
+	}
+	config, err := loadScoringConfig(appSettings.ScoringConfigFile)
+	if err != nil {
+		log.Fatalf("unable to load scoring config: %v", err)
+	}
+	scoringConfig = config
+	if appSettings.AsyncScoring {
+		startScoringWorkers(appSettings.ScoringWorkers)
+	}
+	if auditLog, err = openAuditLog(appSettings.AuditLog); err != nil {
+		log.Fatalf("unable to open audit log: %v", err)
+	}
+	if appSettings.DevMode && appSettings.DeterministicIDs {
+		idGenerator = &sequentialGenerator{}
+	}
+	if appSettings.ContentIDs {
+		idGenerator = contentGenerator{}
+	}
+	// the consumer assigns IDs as soon as it starts, so it must see the final generator
+	startQueueConsumer(ctxpkg.Background(), appSettings)
 
-	// start the server and listen on localhost:9090
-	router.Run("localhost:9090")
+	// start the server and listen on localhost:9090, over TLS when a cert and key are configured
+	server := newServer(setupRouter(), appSettings)
+	if err := serve(server, appSettings); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("server stopped: %v", err)
+	}
 }
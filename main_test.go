@@ -0,0 +1,1052 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// targetReceipt is the first example receipt from the spec, worth 28 points
+const targetReceipt = `{
+  "retailer": "Target",
+  "purchaseDate": "2022-01-01",
+  "purchaseTime": "13:01",
+  "items": [
+    {"shortDescription": "Mountain Dew 12PK", "price": "6.49"},
+    {"shortDescription": "Emils Cheese Pizza", "price": "12.25"},
+    {"shortDescription": "Knorr Creamy Chicken", "price": "1.26"},
+    {"shortDescription": "Doritos Nacho Cheese", "price": "3.35"},
+    {"shortDescription": "   Klarbrunn 12-PK 12 FL OZ  ", "price": "12.00"}
+  ],
+  "total": "35.35"
+}`
+
+// cornerMarketReceipt is the second example receipt from the spec, worth 109 points
+const cornerMarketReceipt = `{
+  "retailer": "M&M Corner Market",
+  "purchaseDate": "2022-03-20",
+  "purchaseTime": "14:33",
+  "items": [
+    {"shortDescription": "Gatorade", "price": "2.25"},
+    {"shortDescription": "Gatorade", "price": "2.25"},
+    {"shortDescription": "Gatorade", "price": "2.25"},
+    {"shortDescription": "Gatorade", "price": "2.25"}
+  ],
+  "total": "9.00"
+}`
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// resetState restores the settings, scoring config, stores and hooks shared by the handlers to their defaults
+func resetState(t *testing.T) {
+	t.Helper()
+	restoreState()
+	// reset again once the test is done, so settings it changed don't leak into tests that don't call resetState
+	t.Cleanup(restoreState)
+}
+
+// restoreState puts every package-level setting and store back to its default
+func restoreState() {
+	appSettings = defaultSettings()
+	scoringConfig = defaultScoringConfig()
+	store = newReceiptStore()
+	tenants = &tenantRegistry{stores: map[string]*receiptStore{defaultTenant: store}}
+	idGenerator = uuidGenerator{}
+	auditLog = nil
+	now = time.Now
+}
+
+// doRequest sends a request with an optional body and headers (as name/value pairs) to a fresh router
+func doRequest(t *testing.T, method string, path string, body string, headers ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	for i := 0; i+1 < len(headers); i += 2 {
+		request.Header.Set(headers[i], headers[i+1])
+	}
+	recorder := httptest.NewRecorder()
+	setupRouter().ServeHTTP(recorder, request)
+	return recorder
+}
+
+// processTestReceipt processes a receipt body and returns its ID, failing the test if it isn't accepted
+func processTestReceipt(t *testing.T, body string, headers ...string) string {
+	t.Helper()
+	recorder := doRequest(t, http.MethodPost, "/receipts/process", body, headers...)
+	if recorder.Code != http.StatusOK && recorder.Code != http.StatusCreated {
+		t.Fatalf("process returned %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var id returnID
+	decodeBody(t, recorder, &id)
+	return id.ID
+}
+
+// withFields returns a receipt body with the given top-level fields set or replaced
+func withFields(t *testing.T, body string, fields map[string]interface{}) string {
+	t.Helper()
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range fields {
+		decoded[key] = value
+	}
+	encoded, err := json.Marshal(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(encoded)
+}
+
+// decodeBody unmarshals a JSON response body into v, failing the test if it isn't valid JSON
+func decodeBody(t *testing.T, recorder *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(recorder.Body.Bytes(), v); err != nil {
+		t.Fatalf("invalid JSON response %q: %v", recorder.Body.String(), err)
+	}
+}
+
+// testPoints fetches a receipt's points, failing the test unless the request succeeds
+func testPoints(t *testing.T, id string, headers ...string) int {
+	t.Helper()
+	recorder := doRequest(t, http.MethodGet, "/receipts/"+id+"/points", "", headers...)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("points returned %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var points returnPoints
+	decodeBody(t, recorder, &points)
+	return points.Points
+}
+
+func TestSpecExamples(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		points int
+	}{
+		{"target", targetReceipt, 28},
+		{"corner market", cornerMarketReceipt, 109},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetState(t)
+			if points := testPoints(t, processTestReceipt(t, test.body)); points != test.points {
+				t.Errorf("points = %d, want %d", points, test.points)
+			}
+		})
+	}
+}
+
+func TestRecalculateAll(t *testing.T) {
+	resetState(t)
+	appSettings.DevMode = true
+	targetID := processTestReceipt(t, targetReceipt)
+	cornerID := processTestReceipt(t, cornerMarketReceipt)
+	testPoints(t, targetID)
+	testPoints(t, cornerID)
+	store.add(receipt{ID: "unscorable", Retailer: "Bad", PurchaseDate: "2022-01-01", PurchaseTime: "13:01", Total: "x"})
+
+	// doubling the round-dollar bonus only changes the corner market receipt's 9.00 total
+	scoringConfig.RoundDollarPoints = 100
+	recorder := doRequest(t, http.MethodPost, "/receipts/recalculate-all", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("recalculate-all returned %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var summary recalculateSummary
+	decodeBody(t, recorder, &summary)
+	if summary.Processed != 2 || summary.Errors != 1 {
+		t.Errorf("summary = %+v, want 2 processed and 1 error", summary)
+	}
+
+	for id, want := range map[string]int{targetID: 28, cornerID: 159} {
+		if r, _ := store.get(id); r.Points != want {
+			t.Errorf("cached points for %s = %d, want %d", id, r.Points, want)
+		}
+	}
+}
+
+func TestRecalculateAllRequiresDevMode(t *testing.T) {
+	resetState(t)
+	if recorder := doRequest(t, http.MethodPost, "/receipts/recalculate-all", ""); recorder.Code != http.StatusNotFound {
+		t.Errorf("recalculate-all outside dev mode returned %d, want 404", recorder.Code)
+	}
+}
+
+func TestProcessReceiptBindErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		error string
+		field string
+	}{
+		{"type mismatch", `{"retailer": 12, "total": "1.00"}`, "expected string but got number", "retailer"},
+		{"truncated body", `{"retailer": "Target", "total": `, "unexpected end of JSON input", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetState(t)
+			recorder := doRequest(t, http.MethodPost, "/receipts/process", test.body)
+			if recorder.Code != http.StatusBadRequest {
+				t.Fatalf("process returned %d, want 400", recorder.Code)
+			}
+
+			var details map[string]interface{}
+			decodeBody(t, recorder, &details)
+			if details["error"] != test.error {
+				t.Errorf("error = %v, want %q", details["error"], test.error)
+			}
+			if test.field != "" {
+				if details["field"] != test.field {
+					t.Errorf("field = %v, want %q", details["field"], test.field)
+				}
+				if _, ok := details["offset"]; !ok {
+					t.Error("type mismatch reported no offset")
+				}
+			}
+		})
+	}
+}
+
+func TestGetReceiptCount(t *testing.T) {
+	resetState(t)
+	processTestReceipt(t, targetReceipt)
+	processTestReceipt(t, targetReceipt)
+	processTestReceipt(t, cornerMarketReceipt)
+
+	tests := []struct {
+		query string
+		count int
+	}{
+		{"", 3},
+		{"?retailer=target", 2},
+		{"?startDate=2022-03-01", 1},
+		{"?startDate=2022-01-01&endDate=2022-01-31", 2},
+		{"?retailer=Target&startDate=2022-02-01", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			recorder := doRequest(t, http.MethodGet, "/receipts/count"+test.query, "")
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("count returned %d: %s", recorder.Code, recorder.Body.String())
+			}
+			var count returnCount
+			decodeBody(t, recorder, &count)
+			if count.Count != test.count {
+				t.Errorf("count = %d, want %d", count.Count, test.count)
+			}
+		})
+	}
+}
+
+func TestGetPointsByExternalId(t *testing.T) {
+	resetState(t)
+	processTestReceipt(t, withFields(t, targetReceipt, map[string]interface{}{"externalId": "order-17"}))
+
+	tests := []struct {
+		externalID string
+		status     int
+		points     int
+	}{
+		{"order-17", http.StatusOK, 28},
+		{"order-18", http.StatusNotFound, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.externalID, func(t *testing.T) {
+			recorder := doRequest(t, http.MethodGet, "/receipts/by-external/"+test.externalID+"/points", "")
+			if recorder.Code != test.status {
+				t.Fatalf("by-external returned %d, want %d", recorder.Code, test.status)
+			}
+			if test.status != http.StatusOK {
+				return
+			}
+			var points returnPoints
+			decodeBody(t, recorder, &points)
+			if points.Points != test.points {
+				t.Errorf("points = %d, want %d", points.Points, test.points)
+			}
+		})
+	}
+}
+
+func TestProcessRejectsDuplicateKeys(t *testing.T) {
+	resetState(t)
+	body := `{"retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01",
+		"items": [{"shortDescription": "Dew", "price": "1.00"}], "total": "1.00", "total": "100.00"}`
+	recorder := doRequest(t, http.MethodPost, "/receipts/process", body)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("duplicate total returned %d, want 400", recorder.Code)
+	}
+	if !strings.Contains(recorder.Body.String(), "total") {
+		t.Errorf("error %s doesn't name the duplicate key", recorder.Body.String())
+	}
+	if count := len(store.list()); count != 0 {
+		t.Errorf("store holds %d receipts, want 0", count)
+	}
+}
+
+// ruleSums fetches the rules summary and indexes its contributions by rule name
+func ruleSums(t *testing.T) (rulesSummary, map[string]int) {
+	t.Helper()
+	recorder := doRequest(t, http.MethodGet, "/receipts/rules-summary", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("rules-summary returned %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var summary rulesSummary
+	decodeBody(t, recorder, &summary)
+	sums := map[string]int{}
+	for _, contribution := range summary.Rules {
+		sums[contribution.Rule] = contribution.Points
+	}
+	return summary, sums
+}
+
+func TestGetRulesSummary(t *testing.T) {
+	resetState(t)
+	processTestReceipt(t, targetReceipt)
+	processTestReceipt(t, cornerMarketReceipt)
+
+	summary, sums := ruleSums(t)
+	if summary.Receipts != 2 || summary.Errors != 0 {
+		t.Errorf("summary covers %d receipts with %d errors, want 2 and 0", summary.Receipts, summary.Errors)
+	}
+	want := map[string]int{
+		"retailerName":    20,
+		"roundDollar":     50,
+		"quarterMultiple": 25,
+		"itemPairs":       20,
+		"itemDescription": 6,
+		"oddDay":          6,
+		"afternoon":       10,
+	}
+	for rule, points := range want {
+		if sums[rule] != points {
+			t.Errorf("%s contributed %d, want %d", rule, sums[rule], points)
+		}
+	}
+}
+
+func TestGetRulesSummaryAdjustments(t *testing.T) {
+	resetState(t)
+	scoringConfig.MaxPoints = 10
+	id := processTestReceipt(t, targetReceipt)
+
+	summary, sums := ruleSums(t)
+	if sums[maxPointsAdjustmentName] != -18 {
+		t.Errorf("%s contributed %d, want -18", maxPointsAdjustmentName, sums[maxPointsAdjustmentName])
+	}
+	if last := summary.Rules[len(summary.Rules)-1]; last.Rule != maxPointsAdjustmentName {
+		t.Errorf("last summary entry = %s, want adjustments after the rules", last.Rule)
+	}
+	total := 0
+	for _, contribution := range summary.Rules {
+		total += contribution.Points
+	}
+	if points := testPoints(t, id); total != points || points != 10 {
+		t.Errorf("summary adds up to %d, receipt earned %d, want both 10", total, points)
+	}
+}
+
+func TestGetRulesSummaryEmptyStore(t *testing.T) {
+	resetState(t)
+	summary, sums := ruleSums(t)
+	if summary.Receipts != 0 || len(summary.Rules) == 0 {
+		t.Errorf("empty store summary = %+v, want every rule with no receipts", summary)
+	}
+	for rule, points := range sums {
+		if points != 0 {
+			t.Errorf("%s contributed %d on an empty store", rule, points)
+		}
+	}
+}
+
+func TestProcessLocationHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		created bool
+		status  int
+	}{
+		{"default", false, http.StatusOK},
+		{"created status", true, http.StatusCreated},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetState(t)
+			appSettings.ProcessCreated = test.created
+			recorder := doRequest(t, http.MethodPost, "/receipts/process", targetReceipt)
+			if recorder.Code != test.status {
+				t.Fatalf("process returned %d, want %d", recorder.Code, test.status)
+			}
+			var id returnID
+			decodeBody(t, recorder, &id)
+			if location := recorder.Header().Get("Location"); location != "/receipts/"+id.ID+"/points" {
+				t.Errorf("Location = %q, want /receipts/%s/points", location, id.ID)
+			}
+		})
+	}
+}
+
+func TestGetReceiptsNDJSON(t *testing.T) {
+	resetState(t)
+	ids := map[string]bool{}
+	for _, body := range []string{targetReceipt, cornerMarketReceipt, targetReceipt} {
+		ids[processTestReceipt(t, body)] = true
+	}
+
+	recorder := doRequest(t, http.MethodGet, "/receipts?format=ndjson", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("ndjson listing returned %d", recorder.Code)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q, want application/x-ndjson", contentType)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(recorder.Body.String(), "\n"), "\n")
+	if len(lines) != len(store.list()) {
+		t.Fatalf("got %d lines, want %d", len(lines), len(store.list()))
+	}
+	for _, line := range lines {
+		var r receipt
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("line %q isn't a receipt: %v", line, err)
+		}
+		if !ids[r.ID] {
+			t.Errorf("line lists unknown receipt %s", r.ID)
+		}
+	}
+}
+
+func TestGetReceiptsWithPoints(t *testing.T) {
+	resetState(t)
+	processTestReceipt(t, targetReceipt)
+	processTestReceipt(t, cornerMarketReceipt)
+
+	tests := []struct {
+		query  string
+		points []int
+	}{
+		{"", []int{0, 0}},
+		{"?withPoints=true", []int{28, 109}},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			var listed []receipt
+			decodeBody(t, doRequest(t, http.MethodGet, "/receipts"+test.query, ""), &listed)
+			points := []int{}
+			for _, r := range listed {
+				points = append(points, r.Points)
+			}
+			if !reflect.DeepEqual(points, test.points) {
+				t.Errorf("points = %v, want %v", points, test.points)
+			}
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	request := httptest.NewRequest(http.MethodGet, "/receipts?withPoints=true", nil).WithContext(ctx)
+	cancelled := httptest.NewRecorder()
+	setupRouter().ServeHTTP(cancelled, request)
+	if cancelled.Code != http.StatusServiceUnavailable {
+		t.Errorf("cancelled listing returned %d, want 503", cancelled.Code)
+	}
+}
+
+func TestUpdateReceiptVersions(t *testing.T) {
+	resetState(t)
+	id := processTestReceipt(t, targetReceipt)
+
+	tests := []struct {
+		name    string
+		ifMatch string
+		status  int
+		version int
+	}{
+		{"current version", `"1"`, http.StatusOK, 2},
+		{"stale version", `"1"`, http.StatusConflict, 2},
+		{"weak current version", `W/"2"`, http.StatusOK, 3},
+		{"any version", "*", http.StatusOK, 4},
+		{"unconditional", "", http.StatusOK, 5},
+		{"malformed version", "abc", http.StatusBadRequest, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			headers := []string{}
+			if test.ifMatch != "" {
+				headers = append(headers, "If-Match", test.ifMatch)
+			}
+			recorder := doRequest(t, http.MethodPut, "/receipts/"+id, cornerMarketReceipt, headers...)
+			if recorder.Code != test.status {
+				t.Fatalf("update returned %d, want %d: %s", recorder.Code, test.status, recorder.Body.String())
+			}
+			if test.version == 0 {
+				return
+			}
+			var version returnVersion
+			decodeBody(t, recorder, &version)
+			if version.Version != test.version {
+				t.Errorf("version = %d, want %d", version.Version, test.version)
+			}
+		})
+	}
+
+	if r, _ := store.get(id); r.Retailer != "M&M Corner Market" || r.Version != 5 {
+		t.Errorf("stored receipt is %s at version %d, want the update at version 5", r.Retailer, r.Version)
+	}
+}
+
+func TestDeleteReceipts(t *testing.T) {
+	resetState(t)
+	first := processTestReceipt(t, targetReceipt)
+	second := processTestReceipt(t, cornerMarketReceipt)
+	kept := processTestReceipt(t, targetReceipt)
+	missing := "3f2504e0-4f89-41d3-9a0c-0305e82c3301"
+
+	body := `{"ids": ["` + first + `", "` + missing + `", "` + second + `"]}`
+	recorder := doRequest(t, http.MethodPost, "/receipts/delete", body)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("delete returned %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var result deleteResult
+	decodeBody(t, recorder, &result)
+	if !reflect.DeepEqual(result.Deleted, []string{first, second}) || !reflect.DeepEqual(result.NotFound, []string{missing}) {
+		t.Errorf("result = %+v, want %s and %s deleted and %s not found", result, first, second, missing)
+	}
+
+	for id, want := range map[string]bool{first: false, second: false, kept: true} {
+		if _, ok := store.get(id); ok != want {
+			t.Errorf("receipt %s stored = %t, want %t", id, ok, want)
+		}
+	}
+}
+
+func TestSoftDelete(t *testing.T) {
+	resetState(t)
+	appSettings.SoftDelete = true
+	deletedTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	deleted := processTestReceipt(t, targetReceipt)
+	kept := processTestReceipt(t, cornerMarketReceipt)
+
+	fixedNow(t, deletedTime)
+	if recorder := doRequest(t, http.MethodPost, "/receipts/delete", `{"ids": ["`+deleted+`"]}`); recorder.Code != http.StatusOK {
+		t.Fatalf("delete returned %d: %s", recorder.Code, recorder.Body.String())
+	}
+	stored, ok := store.get(deleted)
+	if !ok || stored.DeletedAt == nil || !stored.DeletedAt.Equal(deletedTime) || !stored.UpdatedAt.Equal(deletedTime) {
+		t.Fatalf("stored receipt = %+v, want it kept with deletedAt and updatedAt %v", stored, deletedTime)
+	}
+
+	// listIDs lists the receipts /receipts returns for a query
+	listIDs := func(query string) []string {
+		var listed []receipt
+		decodeBody(t, doRequest(t, http.MethodGet, "/receipts"+query, ""), &listed)
+		ids := []string{}
+		for _, r := range listed {
+			ids = append(ids, r.ID)
+		}
+		return ids
+	}
+	if ids := listIDs(""); !reflect.DeepEqual(ids, []string{kept}) {
+		t.Errorf("listed %v, want only %s", ids, kept)
+	}
+	if ids := listIDs("?includeDeleted=true"); !reflect.DeepEqual(ids, []string{deleted, kept}) {
+		t.Errorf("listed %v with includeDeleted, want %s and %s", ids, deleted, kept)
+	}
+	var count returnCount
+	decodeBody(t, doRequest(t, http.MethodGet, "/receipts/count", ""), &count)
+	if count.Count != 1 {
+		t.Errorf("count = %d, want 1", count.Count)
+	}
+	var retailers struct {
+		Retailers []string `json:"retailers"`
+	}
+	decodeBody(t, doRequest(t, http.MethodGet, "/retailers", ""), &retailers)
+	if !reflect.DeepEqual(retailers.Retailers, []string{"M&M Corner Market"}) {
+		t.Errorf("retailers = %v, want only the kept receipt's", retailers.Retailers)
+	}
+	if recorder := doRequest(t, http.MethodGet, "/receipts/"+deleted+"/points", ""); recorder.Code != http.StatusNotFound {
+		t.Errorf("points for a deleted receipt returned %d, want 404", recorder.Code)
+	}
+	var again deleteResult
+	decodeBody(t, doRequest(t, http.MethodPost, "/receipts/delete", `{"ids": ["`+deleted+`"]}`), &again)
+	if !reflect.DeepEqual(again.NotFound, []string{deleted}) {
+		t.Errorf("deleting again = %+v, want %s reported as not found", again, deleted)
+	}
+
+	restoredTime := deletedTime.Add(time.Hour)
+	fixedNow(t, restoredTime)
+	if recorder := doRequest(t, http.MethodPost, "/receipts/"+deleted+"/restore", ""); recorder.Code != http.StatusOK {
+		t.Fatalf("restore returned %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if stored, _ := store.get(deleted); stored.DeletedAt != nil || !stored.UpdatedAt.Equal(restoredTime) {
+		t.Errorf("restored receipt = %+v, want no deletedAt and updatedAt %v", stored, restoredTime)
+	}
+	if points := testPoints(t, deleted); points != 28 {
+		t.Errorf("restored points = %d, want 28", points)
+	}
+	if recorder := doRequest(t, http.MethodPost, "/receipts/"+deleted+"/restore", ""); recorder.Code != http.StatusConflict {
+		t.Errorf("restoring a live receipt returned %d, want 409", recorder.Code)
+	}
+	if recorder := doRequest(t, http.MethodPost, "/receipts/3f2504e0-4f89-41d3-9a0c-0305e82c3301/restore", ""); recorder.Code != http.StatusNotFound {
+		t.Errorf("restoring an unknown receipt returned %d, want 404", recorder.Code)
+	}
+}
+
+func TestDuplicateWindow(t *testing.T) {
+	resetState(t)
+	appSettings.DuplicateWindow = time.Minute
+	submitted := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	fixedNow(t, submitted)
+	first := processTestReceipt(t, targetReceipt)
+
+	// a double tap only needs the same retailer, date and total; the items may differ
+	doubleTap := withFields(t, targetReceipt, map[string]interface{}{
+		"retailer": "TARGET",
+		"total":    "35.35",
+		"items":    []map[string]string{{"shortDescription": "Pepsi", "price": "35.35"}},
+	})
+	tests := []struct {
+		name   string
+		after  time.Duration
+		body   string
+		merged bool
+	}{
+		{"double tap within the window", 30 * time.Second, doubleTap, true},
+		{"different total within the window", 30 * time.Second, withFields(t, targetReceipt, map[string]interface{}{"total": "35.36"}), false},
+		{"resubmitted after the window", 2 * time.Minute, targetReceipt, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fixedNow(t, submitted.Add(test.after))
+			before := len(store.list())
+			id := processTestReceipt(t, test.body)
+			if merged := id == first; merged != test.merged {
+				t.Errorf("merged = %t, want %t", merged, test.merged)
+			}
+			if grown := len(store.list()) - before; grown != map[bool]int{true: 0, false: 1}[test.merged] {
+				t.Errorf("store grew by %d", grown)
+			}
+		})
+	}
+}
+
+func TestGetTier(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want returnTier
+	}{
+		{"bronze", targetReceipt, returnTier{Points: 28, Tier: "bronze"}},
+		{"gold", cornerMarketReceipt, returnTier{Points: 109, Tier: "gold"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetState(t)
+			recorder := doRequest(t, http.MethodGet, "/receipts/"+processTestReceipt(t, test.body)+"/tier", "")
+			var tier returnTier
+			decodeBody(t, recorder, &tier)
+			if tier != test.want {
+				t.Errorf("tier = %+v, want %+v", tier, test.want)
+			}
+		})
+	}
+}
+
+func TestGetFull(t *testing.T) {
+	resetState(t)
+	id := processTestReceipt(t, targetReceipt)
+
+	recorder := doRequest(t, http.MethodGet, "/receipts/"+id+"/full", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("full returned %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var full returnFull
+	decodeBody(t, recorder, &full)
+	if full.Receipt.ID != id || full.Receipt.Retailer != "Target" {
+		t.Errorf("receipt = %s from %s, want %s from Target", full.Receipt.ID, full.Receipt.Retailer, id)
+	}
+	if full.Points != 28 {
+		t.Errorf("points = %d, want 28", full.Points)
+	}
+	sum := 0
+	for _, contribution := range full.Breakdown {
+		sum += contribution.Points
+	}
+	if len(full.Breakdown) == 0 || sum != full.Points {
+		t.Errorf("breakdown %+v sums to %d, want %d", full.Breakdown, sum, full.Points)
+	}
+
+	if recorder := doRequest(t, http.MethodGet, "/receipts/3f2504e0-4f89-41d3-9a0c-0305e82c3301/full", ""); recorder.Code != http.StatusNotFound {
+		t.Errorf("full for an unknown id returned %d, want 404", recorder.Code)
+	}
+}
+
+func TestGetFullAfterHistoryChanges(t *testing.T) {
+	resetState(t)
+	scoringConfig.StreakBonus = 25
+	id := processTestReceipt(t, withFields(t, targetReceipt, map[string]interface{}{"purchaseDate": "2022-01-03"}))
+	if points := testPoints(t, id); points != 28 {
+		t.Fatalf("points before the streak = %d, want 28", points)
+	}
+
+	// the earlier days complete a streak ending at the cached receipt
+	processTestReceipt(t, withFields(t, targetReceipt, map[string]interface{}{"purchaseDate": "2022-01-01"}))
+	processTestReceipt(t, withFields(t, targetReceipt, map[string]interface{}{"purchaseDate": "2022-01-02"}))
+
+	var full returnFull
+	decodeBody(t, doRequest(t, http.MethodGet, "/receipts/"+id+"/full", ""), &full)
+	sum := 0
+	for _, contribution := range full.Breakdown {
+		sum += contribution.Points
+	}
+	if full.Points != 53 || sum != full.Points || full.Receipt.Points != full.Points {
+		t.Errorf("points = %d (receipt %d), breakdown %+v sums to %d, want all 53", full.Points, full.Receipt.Points, full.Breakdown, sum)
+	}
+}
+
+func TestAgeDecayNotCached(t *testing.T) {
+	resetState(t)
+	scoringConfig.AgeDecayFactor = 0.5
+	scoringConfig.AgeDecayPeriodDays = 10
+	fixedNow(t, time.Date(2022, 1, 1, 18, 0, 0, 0, time.UTC))
+	id := processTestReceipt(t, targetReceipt)
+	if points := testPoints(t, id); points != 28 {
+		t.Fatalf("points on the purchase date = %d, want 28", points)
+	}
+
+	fixedNow(t, time.Date(2022, 1, 11, 18, 0, 0, 0, time.UTC))
+	if points := testPoints(t, id); points != 14 {
+		t.Errorf("points ten days later = %d, want 14", points)
+	}
+}
+
+func TestMaxPointsCap(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		points int
+		capped bool
+	}{
+		{"over the cap", cornerMarketReceipt, 100, true},
+		{"under the cap", targetReceipt, 28, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetState(t)
+			scoringConfig.MaxPoints = 100
+			recorder := doRequest(t, http.MethodGet, "/receipts/"+processTestReceipt(t, test.body)+"/full", "")
+			var full returnFull
+			decodeBody(t, recorder, &full)
+			if full.Points != test.points || full.Capped != test.capped {
+				t.Errorf("full = %d points, capped %t, want %d, capped %t", full.Points, full.Capped, test.points, test.capped)
+			}
+		})
+	}
+}
+
+func TestGetReceiptIds(t *testing.T) {
+	resetState(t)
+	processTestReceipt(t, targetReceipt)
+	processTestReceipt(t, cornerMarketReceipt)
+	processTestReceipt(t, targetReceipt)
+
+	for _, query := range []string{"", "?retailer=Target"} {
+		t.Run(query, func(t *testing.T) {
+			var listed []receipt
+			decodeBody(t, doRequest(t, http.MethodGet, "/receipts"+query, ""), &listed)
+			want := []string{}
+			for _, r := range listed {
+				want = append(want, r.ID)
+			}
+
+			var ids returnIDs
+			decodeBody(t, doRequest(t, http.MethodGet, "/receipts/ids"+query, ""), &ids)
+			if !reflect.DeepEqual(ids.IDs, want) {
+				t.Errorf("ids = %v, want %v", ids.IDs, want)
+			}
+		})
+	}
+}
+
+func TestScoreWithConfig(t *testing.T) {
+	resetState(t)
+	id := processTestReceipt(t, targetReceipt)
+
+	tests := []struct {
+		name   string
+		config string
+		points int
+	}{
+		{"default config", `{}`, 28},
+		{"supplied config", `{"retailerLetterPoints": 10}`, 82},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := doRequest(t, http.MethodPost, "/receipts/"+id+"/score-with", test.config)
+			var points returnPoints
+			decodeBody(t, recorder, &points)
+			if points.Points != test.points {
+				t.Errorf("points = %d, want %d", points.Points, test.points)
+			}
+		})
+	}
+
+	if points := testPoints(t, id); points != 28 || scoringConfig.RetailerLetterPoints != 1 {
+		t.Errorf("score-with changed the receipt's points to %d or the active config", points)
+	}
+}
+
+func TestSimulateConfig(t *testing.T) {
+	resetState(t)
+	target := processTestReceipt(t, targetReceipt)
+	cornerMarket := processTestReceipt(t, cornerMarketReceipt)
+
+	// the corner market receipt loses its 50 round-dollar points; the Target one is unaffected
+	recorder := doRequest(t, http.MethodPost, "/receipts/simulate-config", `{"disabledRules": {"roundDollar": true}}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("simulate returned %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var result simulationResult
+	decodeBody(t, recorder, &result)
+	want := simulationResult{
+		CurrentTotal:   137,
+		SimulatedTotal: 87,
+		Delta:          -50,
+		Receipts: []receiptDelta{
+			{ID: target, Current: 28, Simulated: 28, Delta: 0},
+			{ID: cornerMarket, Current: 109, Simulated: 59, Delta: -50},
+		},
+		Errors: map[string]string{},
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("result = %+v, want %+v", result, want)
+	}
+	if points := testPoints(t, cornerMarket); points != 109 {
+		t.Errorf("points after simulating = %d, want the unchanged 109", points)
+	}
+
+	if recorder := doRequest(t, http.MethodPost, "/receipts/simulate-config", `{"disabledRules": true}`); recorder.Code != http.StatusBadRequest {
+		t.Errorf("invalid config returned %d, want 400", recorder.Code)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	request := httptest.NewRequest(http.MethodPost, "/receipts/simulate-config", strings.NewReader(`{}`)).WithContext(ctx)
+	cancelled := httptest.NewRecorder()
+	setupRouter().ServeHTTP(cancelled, request)
+	if cancelled.Code != http.StatusServiceUnavailable {
+		t.Errorf("cancelled simulation returned %d, want 503", cancelled.Code)
+	}
+}
+
+func TestGetRawReceipt(t *testing.T) {
+	resetState(t)
+	appSettings.DevMode = true
+	appSettings.StoreRawBody = true
+	id := processTestReceipt(t, targetReceipt)
+
+	recorder := doRequest(t, http.MethodGet, "/receipts/"+id+"/raw", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("raw returned %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if recorder.Body.String() != targetReceipt {
+		t.Errorf("raw body = %q, want the submitted bytes %q", recorder.Body.String(), targetReceipt)
+	}
+	if r, _ := store.get(id); r.Retailer != "Target" || len(r.Items) != 5 {
+		t.Errorf("keeping the raw body broke binding: stored %+v", r)
+	}
+}
+
+func TestGetRawReceiptNotStored(t *testing.T) {
+	resetState(t)
+	appSettings.DevMode = true
+	id := processTestReceipt(t, targetReceipt)
+	if recorder := doRequest(t, http.MethodGet, "/receipts/"+id+"/raw", ""); recorder.Code != http.StatusNotFound {
+		t.Errorf("raw without STORE_RAW_BODY returned %d, want 404", recorder.Code)
+	}
+}
+
+func TestMissingTimePenalty(t *testing.T) {
+	tests := []struct {
+		name    string
+		time    string
+		penalty int
+		points  int
+	}{
+		{"with a time", "13:01", 10, 28},
+		{"without a time", "", 10, 18},
+		{"without a time, floored at zero", "", 100, 0},
+		{"without a time, no penalty", "", 0, 28},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetState(t)
+			appSettings.LenientParsing = true
+			scoringConfig.MissingTimePenalty = test.penalty
+			body := withFields(t, targetReceipt, map[string]interface{}{"purchaseTime": test.time})
+			if points := testPoints(t, processTestReceipt(t, body)); points != test.points {
+				t.Errorf("points = %d, want %d", points, test.points)
+			}
+		})
+	}
+}
+
+func TestGetScores(t *testing.T) {
+	resetState(t)
+	appSettings.DevMode = true
+	want := map[string]int{
+		processTestReceipt(t, targetReceipt):       28,
+		processTestReceipt(t, cornerMarketReceipt): 109,
+		processTestReceipt(t, targetReceipt):       28,
+	}
+	// a stale cached total must not leak into the fresh scores
+	for id := range want {
+		store.setPoints(id, 1)
+	}
+
+	recorder := doRequest(t, http.MethodGet, "/receipts/scores", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("scores returned %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var scores returnScores
+	decodeBody(t, recorder, &scores)
+	if !reflect.DeepEqual(scores.Scores, want) || len(scores.Errors) != 0 {
+		t.Errorf("scores = %v with errors %v, want %v", scores.Scores, scores.Errors, want)
+	}
+}
+
+func TestGetTopReceipts(t *testing.T) {
+	resetState(t)
+	first := processTestReceipt(t, targetReceipt)
+	corner := processTestReceipt(t, cornerMarketReceipt)
+	second := processTestReceipt(t, targetReceipt)
+
+	tests := []struct {
+		query  string
+		status int
+		want   []string
+	}{
+		{"", http.StatusOK, []string{corner, first, second}},
+		{"?n=2", http.StatusOK, []string{corner, first}},
+		{"?n=10", http.StatusOK, []string{corner, first, second}},
+		{"?n=0", http.StatusOK, []string{}},
+		{"?n=-1", http.StatusBadRequest, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			recorder := doRequest(t, http.MethodGet, "/receipts/top"+test.query, "")
+			if recorder.Code != test.status || test.status != http.StatusOK {
+				if recorder.Code != test.status {
+					t.Errorf("top returned %d, want %d", recorder.Code, test.status)
+				}
+				return
+			}
+			var top []receipt
+			decodeBody(t, recorder, &top)
+			ids := []string{}
+			for _, r := range top {
+				ids = append(ids, r.ID)
+			}
+			if !reflect.DeepEqual(ids, test.want) {
+				t.Errorf("top = %v, want %v", ids, test.want)
+			}
+		})
+	}
+}
+
+func TestNonParticipatingRetailers(t *testing.T) {
+	tests := []struct {
+		name   string
+		action string
+		body   string
+		status int
+		points int
+	}{
+		{"allowed", "zero", targetReceipt, http.StatusOK, 28},
+		{"denied scores zero", "zero", cornerMarketReceipt, http.StatusOK, 0},
+		{"denied is rejected", "reject", cornerMarketReceipt, http.StatusBadRequest, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetState(t)
+			scoringConfig.DeniedRetailers = []string{"m&m corner market"}
+			scoringConfig.NonParticipatingAction = test.action
+			recorder := doRequest(t, http.MethodPost, "/receipts/process", test.body)
+			if recorder.Code != test.status {
+				t.Fatalf("process returned %d, want %d", recorder.Code, test.status)
+			}
+			if test.status != http.StatusOK {
+				return
+			}
+			var id returnID
+			decodeBody(t, recorder, &id)
+			if points := testPoints(t, id.ID); points != test.points {
+				t.Errorf("points = %d, want %d", points, test.points)
+			}
+		})
+	}
+}
+
+func TestPointsCacheControl(t *testing.T) {
+	tests := []struct {
+		name   string
+		maxAge time.Duration
+		total  string
+		status int
+		want   string
+	}{
+		{"computed points", time.Minute, "35.35", http.StatusOK, "private, max-age=60"},
+		{"caching disabled", 0, "35.35", http.StatusOK, "no-store"},
+		{"points can't be computed", time.Minute, "x", http.StatusBadRequest, "no-store"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetState(t)
+			appSettings.PointsMaxAge = test.maxAge
+			store.add(receipt{ID: "3f2504e0-4f89-41d3-9a0c-0305e82c3301", Retailer: "Target", PurchaseDate: "2022-01-01", PurchaseTime: "13:01", Total: test.total})
+
+			recorder := doRequest(t, http.MethodGet, "/receipts/3f2504e0-4f89-41d3-9a0c-0305e82c3301/points", "")
+			if recorder.Code != test.status {
+				t.Fatalf("points returned %d, want %d", recorder.Code, test.status)
+			}
+			if cacheControl := recorder.Header().Get("Cache-Control"); cacheControl != test.want {
+				t.Errorf("Cache-Control = %q, want %q", cacheControl, test.want)
+			}
+			if vary := recorder.Header().Get("Vary"); vary != "X-Tenant-Id" {
+				t.Errorf("Vary = %q, want X-Tenant-Id", vary)
+			}
+		})
+	}
+}
+
+func TestGetLatestPoints(t *testing.T) {
+	resetState(t)
+	appSettings.SoftDelete = true
+	if recorder := doRequest(t, http.MethodGet, "/receipts/latest/points", ""); recorder.Code != http.StatusNotFound {
+		t.Errorf("latest points on an empty store returned %d, want 404", recorder.Code)
+	}
+
+	processTestReceipt(t, targetReceipt)
+	if points := testPoints(t, "latest"); points != 28 {
+		t.Errorf("latest points after one receipt = %d, want 28", points)
+	}
+	latest := processTestReceipt(t, cornerMarketReceipt)
+	if points := testPoints(t, "latest"); points != 109 {
+		t.Errorf("latest points after a second receipt = %d, want 109", points)
+	}
+
+	// deleting the latest receipt falls back to the one before it
+	doRequest(t, http.MethodPost, "/receipts/delete", `{"ids": ["`+latest+`"]}`)
+	if points := testPoints(t, "latest"); points != 28 {
+		t.Errorf("latest points after deleting the newest = %d, want 28", points)
+	}
+}
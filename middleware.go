@@ -0,0 +1,133 @@
+package main
+
+import (
+	ctxpkg "context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// validateID is a middleware that rejects a malformed :id path param with a 400 before any store lookup,
+// and normalizes well-formed IDs to the canonical lowercase UUID form
+func validateID(context *gin.Context) {
+	parsed, err := uuid.Parse(context.Param("id"))
+	if err != nil {
+		abortWithError(context, http.StatusBadRequest, "The receipt id is not a valid UUID", nil)
+		return
+	}
+
+	for i, param := range context.Params {
+		if param.Key == "id" {
+			context.Params[i].Value = parsed.String()
+		}
+	}
+	context.Next()
+}
+
+// devOnly is a middleware that hides development-only endpoints unless DEV_MODE is enabled
+func devOnly(context *gin.Context) {
+	if !appSettings.DevMode {
+		abortWithError(context, http.StatusNotFound, "Not found", nil)
+		return
+	}
+	context.Next()
+}
+
+// scoringConfigKey is the gin context key set by overrideScoringConfig
+const scoringConfigKey = "scoringConfig"
+
+// overrideScoringConfig is a middleware that, in DEV_MODE, scores the request with the base64-encoded JSON
+// ScoringConfig in the X-Scoring-Config header instead of the server's config, without changing or caching
+// anything. Fields missing from it take their default values. The header is ignored outside DEV_MODE.
+func overrideScoringConfig(context *gin.Context) {
+	header := context.GetHeader("X-Scoring-Config")
+	if !appSettings.DevMode || header == "" {
+		context.Next()
+		return
+	}
+
+	data, err := base64.StdEncoding.DecodeString(header)
+	if err != nil {
+		abortWithError(context, http.StatusBadRequest, "The X-Scoring-Config header must be base64-encoded", nil)
+		return
+	}
+	config := defaultScoringConfig()
+	if err := json.Unmarshal(data, &config); err != nil {
+		abortWithError(context, http.StatusBadRequest, "The scoring config is invalid", gin.H{"error": err.Error()})
+		return
+	}
+
+	context.Set(scoringConfigKey, config)
+	context.Next()
+}
+
+// requestScoringConfig returns the config to score the request with, and whether it was overridden by
+// the X-Scoring-Config header
+func requestScoringConfig(context *gin.Context) (ScoringConfig, bool) {
+	if config, ok := context.Get(scoringConfigKey); ok {
+		return config.(ScoringConfig), true
+	}
+	return scoringConfig, false
+}
+
+// limitConcurrency is a middleware allowing at most max requests in flight at once; requests beyond that
+// are turned away with a 503 rather than queued. The slot is released when the request finishes, even if
+// a later handler panics. A max of 0 or less disables the limit.
+func limitConcurrency(max int) gin.HandlerFunc {
+	if max <= 0 {
+		return func(context *gin.Context) { context.Next() }
+	}
+
+	slots := make(chan struct{}, max)
+	return func(context *gin.Context) {
+		select {
+		case slots <- struct{}{}:
+		default:
+			abortWithError(context, http.StatusServiceUnavailable, "The server is busy, please retry shortly", nil)
+			return
+		}
+		defer func() { <-slots }()
+
+		context.Next()
+	}
+}
+
+// requestIDKey is the gin context key holding the current request's ID
+const requestIDKey = "requestID"
+
+// assignRequestID is a middleware that tags each request with the client's X-Request-ID, or a new UUID when
+// none is sent, and echoes it back in the response so log and audit entries can be correlated
+func assignRequestID(context *gin.Context) {
+	requestID := context.GetHeader("X-Request-ID")
+	if requestID == "" {
+		requestID = uuid.NewString()
+	}
+	context.Set(requestIDKey, requestID)
+	context.Header("X-Request-ID", requestID)
+	context.Next()
+}
+
+// requestTimeout is a middleware that gives each request's context a deadline: the route's entry in
+// routeTimeouts (keyed by method and route pattern, e.g. "GET /receipts/:id/points") or def otherwise.
+// Long-running handlers watch the request context and stop with a 503 once it expires.
+func requestTimeout(def time.Duration, routeTimeouts map[string]time.Duration) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		timeout, ok := routeTimeouts[context.Request.Method+" "+context.FullPath()]
+		if !ok {
+			timeout = def
+		}
+		if timeout <= 0 {
+			context.Next()
+			return
+		}
+
+		ctx, cancel := ctxpkg.WithTimeout(context.Request.Context(), timeout)
+		defer cancel()
+		context.Request = context.Request.WithContext(ctx)
+		context.Next()
+	}
+}
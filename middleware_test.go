@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestValidateID(t *testing.T) {
+	resetState(t)
+	id := processTestReceipt(t, targetReceipt)
+
+	tests := []struct {
+		name   string
+		id     string
+		status int
+	}{
+		{"malformed", "not-a-uuid", http.StatusBadRequest},
+		{"well-formed but unknown", "3f2504e0-4f89-41d3-9a0c-0305e82c3301", http.StatusNotFound},
+		{"known", id, http.StatusOK},
+		{"known in upper case", strings.ToUpper(id), http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if recorder := doRequest(t, http.MethodGet, "/receipts/"+test.id+"/points", ""); recorder.Code != test.status {
+				t.Errorf("points for %s returned %d, want %d", test.id, recorder.Code, test.status)
+			}
+		})
+	}
+}
+
+func TestLimitConcurrency(t *testing.T) {
+	const limit = 2
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	router := gin.New()
+	router.Use(gin.Recovery(), limitConcurrency(limit))
+	router.GET("/slow", func(context *gin.Context) {
+		entered <- struct{}{}
+		<-release
+		context.Status(http.StatusOK)
+	})
+	router.GET("/panic", func(context *gin.Context) { panic("handler failed") })
+
+	get := func(path string) int {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder.Code
+	}
+
+	// fill every slot, then send more requests than the limit allows
+	codes := make(chan int, limit)
+	for i := 0; i < limit; i++ {
+		go func() { codes <- get("/slow") }()
+		<-entered
+	}
+	busy := 0
+	for i := 0; i < 3; i++ {
+		if get("/slow") == http.StatusServiceUnavailable {
+			busy++
+		}
+	}
+	close(release)
+	for i := 0; i < limit; i++ {
+		if code := <-codes; code != http.StatusOK {
+			t.Errorf("in-flight request returned %d, want 200", code)
+		}
+	}
+	if busy != 3 {
+		t.Errorf("%d of 3 requests over the limit got 503, want all", busy)
+	}
+
+	// a panicking handler must still give its slot back
+	for i := 0; i < limit+1; i++ {
+		get("/panic")
+	}
+	if code := get("/panic"); code != http.StatusInternalServerError {
+		t.Errorf("after %d panics the next request returned %d, want 500 rather than a leaked-slot 503", limit+1, code)
+	}
+}
+
+func TestRequestTimeoutPerRoute(t *testing.T) {
+	// slow stands in for a handler that watches its request context while working for 50ms
+	slow := func(context *gin.Context) {
+		select {
+		case <-time.After(50 * time.Millisecond):
+			context.Status(http.StatusOK)
+		case <-context.Request.Context().Done():
+			context.Status(http.StatusServiceUnavailable)
+		}
+	}
+	router := gin.New()
+	router.Use(requestTimeout(10*time.Millisecond, map[string]time.Duration{
+		"POST /receipts/bulk": time.Second,
+		"GET /unlimited":      0,
+	}))
+	router.POST("/receipts/bulk", slow)
+	router.GET("/receipts/:id/points", slow)
+	router.GET("/unlimited", slow)
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodPost, "/receipts/bulk", http.StatusOK},
+		{http.MethodGet, "/receipts/1/points", http.StatusServiceUnavailable},
+		{http.MethodGet, "/unlimited", http.StatusOK},
+	}
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(test.method, test.path, nil))
+		if recorder.Code != test.status {
+			t.Errorf("%s %s returned %d, want %d", test.method, test.path, recorder.Code, test.status)
+		}
+	}
+}
+
+// encodedConfig returns the X-Scoring-Config header value for a JSON scoring config
+func encodedConfig(config string) string {
+	return base64.StdEncoding.EncodeToString([]byte(config))
+}
+
+func TestOverrideScoringConfig(t *testing.T) {
+	// without its retailer name, round-dollar and quarter points the corner market receipt (109) drops to 20,
+	// below the Target one (28, dropping to 22)
+	header := encodedConfig(`{"disabledRules": {"retailerName": true, "roundDollar": true, "quarterMultiple": true}}`)
+
+	tests := []struct {
+		name    string
+		devMode bool
+		header  string
+		status  int
+		points  int
+	}{
+		{"dev mode", true, header, http.StatusOK, 20},
+		{"not dev mode", false, header, http.StatusOK, 109},
+		{"no header", true, "", http.StatusOK, 109},
+		{"malformed base64", true, "not base64!", http.StatusBadRequest, 0},
+		{"malformed base64 outside dev mode", false, "not base64!", http.StatusOK, 109},
+		{"invalid config", true, encodedConfig(`{"disabledRules": true}`), http.StatusBadRequest, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetState(t)
+			appSettings.DevMode = test.devMode
+			id := processTestReceipt(t, cornerMarketReceipt)
+
+			recorder := doRequest(t, http.MethodGet, "/receipts/"+id+"/points", "", "X-Scoring-Config", test.header)
+			if recorder.Code != test.status {
+				t.Fatalf("points returned %d, want %d", recorder.Code, test.status)
+			}
+			if test.status == http.StatusOK {
+				var points returnPoints
+				decodeBody(t, recorder, &points)
+				if points.Points != test.points {
+					t.Errorf("points = %d, want %d", points.Points, test.points)
+				}
+			}
+			// the override is never cached for later requests
+			if points := testPoints(t, id); points != 109 {
+				t.Errorf("points without the header afterwards = %d, want 109", points)
+			}
+			// routes that don't score receipts ignore the header
+			if recorder := doRequest(t, http.MethodGet, "/status", "", "X-Scoring-Config", test.header); recorder.Code != http.StatusOK {
+				t.Errorf("status returned %d, want 200", recorder.Code)
+			}
+		})
+	}
+}
+
+func TestOverrideScoringConfigRoutes(t *testing.T) {
+	resetState(t)
+	appSettings.DevMode = true
+	target := processTestReceipt(t, targetReceipt)
+	cornerMarket := processTestReceipt(t, cornerMarketReceipt)
+	// the corner market receipt drops from 109 to 20 and the Target one from 28 to 22
+	header := encodedConfig(`{"disabledRules": {"retailerName": true, "roundDollar": true, "quarterMultiple": true}}`)
+
+	var tier returnTier
+	decodeBody(t, doRequest(t, http.MethodGet, "/receipts/"+cornerMarket+"/tier", "", "X-Scoring-Config", header), &tier)
+	if tier.Points != 20 {
+		t.Errorf("tier points = %d, want 20", tier.Points)
+	}
+
+	var top []receipt
+	decodeBody(t, doRequest(t, http.MethodGet, "/receipts/top", "", "X-Scoring-Config", header), &top)
+	if len(top) != 2 || top[0].ID != target || top[1].ID != cornerMarket {
+		t.Errorf("top = %+v, want the Target receipt ahead of the corner market one", top)
+	}
+
+	var retailer returnRetailerPoints
+	decodeBody(t, doRequest(t, http.MethodGet, "/retailers/Target/points", "", "X-Scoring-Config", header), &retailer)
+	if retailer.Points != 22 {
+		t.Errorf("retailer points = %d, want 22", retailer.Points)
+	}
+
+	// the pizza normally earns 3 description points
+	var items returnItems
+	decodeBody(t, doRequest(t, http.MethodGet, "/items?limit=2", "", "X-Scoring-Config",
+		encodedConfig(`{"disabledRules": {"itemDescription": true}}`)), &items)
+	if len(items.Items) != 2 || items.Items[1].Points != 0 {
+		t.Errorf("items = %+v, want the pizza's description points dropped", items.Items)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// localeFormat describes how a locale writes money amounts
+type localeFormat struct {
+	Decimal     string // decimal separator
+	Thousands   string // digit group separator
+	SymbolAfter bool   // whether the currency symbol follows the amount, e.g. "35,00 €"
+}
+
+// localeFormats are the locales accepted by the LOCALE setting
+var localeFormats = map[string]localeFormat{
+	"en-US": {Decimal: ".", Thousands: ","},
+	"en-GB": {Decimal: ".", Thousands: ","},
+	"de-DE": {Decimal: ",", Thousands: ".", SymbolAfter: true},
+	"fr-FR": {Decimal: ",", Thousands: " ", SymbolAfter: true},
+	"es-ES": {Decimal: ",", Thousands: ".", SymbolAfter: true},
+}
+
+// currencySymbols maps ISO 4217 codes to their symbols; other currencies are written with their code
+var currencySymbols = map[string]string{
+	"USD": "$",
+	"CAD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+}
+
+// formatMoney writes an amount in cents in the given currency the way the locale writes money,
+// e.g. "$1,234.50" for en-US or "1.234,50 €" for de-DE
+func formatMoney(cents int64, currency string, locale localeFormat) string {
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+
+	// group the whole-dollar digits in threes from the right
+	whole := strconv.FormatInt(cents/100, 10)
+	var grouped strings.Builder
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			grouped.WriteString(locale.Thousands)
+		}
+		grouped.WriteRune(digit)
+	}
+	amount := grouped.String() + locale.Decimal + fmt.Sprintf("%02d", cents%100)
+
+	symbol, ok := currencySymbols[currency]
+	if !ok {
+		symbol = currency
+	}
+	if locale.SymbolAfter {
+		return sign + amount + " " + symbol
+	}
+	if !ok {
+		symbol += " "
+	}
+	return sign + symbol + amount
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestFormatMoney(t *testing.T) {
+	tests := []struct {
+		cents    int64
+		currency string
+		locale   string
+		want     string
+	}{
+		{3500, "USD", "en-US", "$35.00"},
+		{123450, "USD", "en-US", "$1,234.50"},
+		{123456789, "GBP", "en-GB", "£1,234,567.89"},
+		{5, "USD", "en-US", "$0.05"},
+		{-3500, "USD", "en-US", "-$35.00"},
+		{3500, "CHF", "en-US", "CHF 35.00"},
+		{123450, "EUR", "de-DE", "1.234,50 €"},
+		{123450, "EUR", "fr-FR", "1\u202f234,50 €"},
+		{3500, "CHF", "de-DE", "35,00 CHF"},
+	}
+	for _, test := range tests {
+		if got := formatMoney(test.cents, test.currency, localeFormats[test.locale]); got != test.want {
+			t.Errorf("formatMoney(%d, %s, %s) = %q, want %q", test.cents, test.currency, test.locale, got, test.want)
+		}
+	}
+}
+
+func TestPointsWithTotal(t *testing.T) {
+	tests := []struct {
+		locale string
+		body   string
+		total  string
+	}{
+		{"en-US", targetReceipt, "$35.35"},
+		{"de-DE", withFields(t, targetReceipt, map[string]interface{}{"schemaVersion": 2, "currency": "EUR"}), "35,35 €"},
+	}
+	for _, test := range tests {
+		t.Run(test.locale, func(t *testing.T) {
+			resetState(t)
+			appSettings.Locale = test.locale
+			id := processTestReceipt(t, test.body)
+
+			var points returnPointsWithTotal
+			decodeBody(t, doRequest(t, http.MethodGet, "/receipts/"+id+"/points?withTotal=true", ""), &points)
+			if points.Points != 28 || points.Total != test.total {
+				t.Errorf("points = %+v, want 28 with total %q", points, test.total)
+			}
+
+			var plain map[string]interface{}
+			decodeBody(t, doRequest(t, http.MethodGet, "/receipts/"+id+"/points", ""), &plain)
+			if _, ok := plain["total"]; ok {
+				t.Errorf("points without withTotal = %v, want no total", plain)
+			}
+		})
+	}
+}
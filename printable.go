@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// printableWidth is the number of characters per line of a printable receipt
+const printableWidth = 40
+
+// printableLine writes a line with label on the left and amount on the right, truncating the label
+// so the line fits in printableWidth. An amount too wide to share a line is written on a line of its own.
+func printableLine(label string, amount string) string {
+	room := printableWidth - utf8.RuneCountInString(amount) - 1
+	if room < 1 {
+		return strings.TrimRight(printableLine(label, ""), " \n") + "\n" + amount + "\n"
+	}
+	if runes := []rune(label); len(runes) > room {
+		label = string(runes[:room])
+	}
+	padding := printableWidth - utf8.RuneCountInString(label) - utf8.RuneCountInString(amount)
+	return label + strings.Repeat(" ", padding) + amount + "\n"
+}
+
+// printableText renders a receipt as a plain-text receipt: the retailer and purchase time, one line per item,
+// the total, and a points footer. Items and total are formatted in the receipt's currency per LOCALE.
+func printableText(r *receipt, points string) string {
+	currency := r.Currency
+	if currency == "" {
+		currency = defaultCurrency
+	}
+	rule := strings.Repeat("-", printableWidth) + "\n"
+
+	var text strings.Builder
+	text.WriteString(r.Retailer + "\n")
+	text.WriteString(strings.TrimSpace(r.PurchaseDate+" "+r.PurchaseTime) + "\n")
+	text.WriteString(rule)
+	for _, it := range r.Items {
+		price := it.Price
+		if cents, err := parseCents(it.Price); err == nil {
+			price = formatMoney(cents, currency, localeFormats[appSettings.Locale])
+		}
+		text.WriteString(printableLine(strings.TrimSpace(it.ShortDescription), price))
+	}
+	text.WriteString(rule)
+	text.WriteString(printableLine("TOTAL", formattedTotal(r)))
+	text.WriteString(printableLine("POINTS", points))
+	return text.String()
+}
+
+// getPrintable takes in a receipt ID and sends the receipt formatted for printing or sharing.
+// Only ?format=text (the default) is supported for now.
+func getPrintable(context *gin.Context) {
+	if format := context.DefaultQuery("format", "text"); format != "text" {
+		respondError(context, http.StatusBadRequest, "format must be text", nil)
+		return
+	}
+
+	receipt, err := getReceiptById(tenantStore(context), context.Param("id"))
+	if err != nil {
+		respondError(context, http.StatusNotFound, "No receipt found for that id", nil)
+		return
+	}
+
+	// a receipt that can't be scored still prints, without its points
+	points := "unavailable"
+	if pointTotal, err := requestPoints(context, receipt); err == nil {
+		points = strconv.Itoa(pointTotal)
+	}
+	context.String(http.StatusOK, printableText(receipt, points))
+}
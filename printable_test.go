@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestGetPrintable(t *testing.T) {
+	resetState(t)
+	id := processTestReceipt(t, targetReceipt)
+
+	recorder := doRequest(t, http.MethodGet, "/receipts/"+id+"/printable?format=text", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("printable returned %d: %s", recorder.Code, recorder.Body.String())
+	}
+	text := recorder.Body.String()
+	for _, want := range []string{
+		"Target\n",
+		"2022-01-01 13:01\n",
+		"Mountain Dew 12PK", "Emils Cheese Pizza", "Knorr Creamy Chicken", "Doritos Nacho Cheese", "Klarbrunn 12-PK 12 FL OZ",
+		"$6.49\n", "$12.25\n", "$1.26\n", "$3.35\n", "$12.00\n",
+		"$35.35\n",
+		"POINTS",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("printable text is missing %q:\n%s", want, text)
+		}
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n")[2:] {
+		if width := utf8.RuneCountInString(line); width != printableWidth {
+			t.Errorf("line %q is %d characters wide, want %d", line, width, printableWidth)
+		}
+	}
+	if !strings.HasSuffix(text, "28\n") {
+		t.Errorf("printable text doesn't end with the 28 points:\n%s", text)
+	}
+
+	if recorder := doRequest(t, http.MethodGet, "/receipts/3f2504e0-4f89-41d3-9a0c-0305e82c3301/printable", ""); recorder.Code != http.StatusNotFound {
+		t.Errorf("printable for an unknown receipt returned %d, want 404", recorder.Code)
+	}
+	if recorder := doRequest(t, http.MethodGet, "/receipts/"+id+"/printable?format=pdf", ""); recorder.Code != http.StatusBadRequest {
+		t.Errorf("printable as pdf returned %d, want 400", recorder.Code)
+	}
+}
+
+func TestPrintableLine(t *testing.T) {
+	tests := []struct {
+		name   string
+		label  string
+		amount string
+		want   string
+	}{
+		{"fits", "Dew", "$1.00", "Dew" + strings.Repeat(" ", 32) + "$1.00\n"},
+		{"long label truncated", strings.Repeat("x", 50), "$1.00", strings.Repeat("x", 34) + " $1.00\n"},
+		{"amount too wide for a line", "Dew", strings.Repeat("9", 45), "Dew\n" + strings.Repeat("9", 45) + "\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := printableLine(test.label, test.amount); got != test.want {
+				t.Errorf("printableLine = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+)
+
+// messageQueue is the minimal interface the receipt consumer needs from a queue/stream backend
+// (e.g. NATS or Kafka). Subscribe blocks, calling handle for each message, until ctx is done.
+type messageQueue interface {
+	Subscribe(ctx context.Context, subject string, handle func(body []byte)) error
+	Publish(subject string, body []byte) error
+}
+
+// queuedPoints is the message emitted downstream once a queued receipt has been scored
+type queuedPoints struct {
+	ID     string `json:"id"`
+	Points int    `json:"points"`
+}
+
+// queueBackends maps each QUEUE_BACKEND value to a constructor for its queue. No network backend ships
+// yet, so QUEUE_BACKEND can't be set until one is registered here; memoryQueue is deliberately left out
+// since nothing in the server publishes to it.
+var queueBackends = map[string]func() messageQueue{}
+
+// ingestQueue is the queue the consumer reads from, set by startQueueConsumer
+var ingestQueue messageQueue
+
+// startQueueConsumer connects to the configured QUEUE_BACKEND and consumes receipts from it in the background
+// until ctx is done. It does nothing when no backend is configured.
+func startQueueConsumer(ctx context.Context, settings settings) {
+	newQueue, ok := queueBackends[settings.QueueBackend]
+	if !ok {
+		return
+	}
+
+	ingestQueue = newQueue()
+	go func() {
+		err := consumeReceipts(ctx, ingestQueue, settings.QueueInSubject, settings.QueueOutSubject, settings.QueueTenant)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("queue: consumer stopped: %v", err)
+		}
+	}()
+}
+
+// consumeReceipts reads receipt JSON messages from inSubject, stores them in the tenant's store and scores them
+// exactly like processReceipt and getPoints, and publishes the computed points to outSubject.
+func consumeReceipts(ctx context.Context, queue messageQueue, inSubject string, outSubject string, tenant string) error {
+	scoped := tenants.storeFor(tenant)
+	return queue.Subscribe(ctx, inSubject, func(body []byte) {
+		if key := findDuplicateKey(body); key != "" {
+			log.Printf("queue: dropping invalid receipt: duplicate key %q", key)
+			return
+		}
+
+		var newReceipt receipt
+		if err := json.Unmarshal(body, &newReceipt); err != nil {
+			log.Printf("queue: dropping invalid receipt: %v", err)
+			return
+		}
+
+		version, err := declaredSchemaVersion("", &newReceipt)
+		if err == nil {
+			applyDefaults(&newReceipt, version, appSettings)
+			err = migrateReceipt(&newReceipt, version)
+		}
+		if err != nil {
+			log.Printf("queue: dropping invalid receipt: %v", err)
+			return
+		}
+
+		if err := validateReceipt(&newReceipt, appSettings); err != nil {
+			log.Printf("queue: dropping invalid receipt: %v", err)
+			return
+		}
+
+		pointTotal, err := calculatePoints(&newReceipt, scoringConfig, scoped)
+		if err != nil {
+			log.Printf("queue: dropping receipt, unable to calculate points (%v)", err)
+			return
+		}
+
+		newReceipt.Points = pointTotal
+		id, merged := addOrMergeReceipt(scoped, newReceipt)
+		if merged {
+			// a double submission; report the points of the receipt already stored
+			if existing, ok := scoped.get(id); ok {
+				pointTotal, _ = pointsFor(scoped, &existing)
+			}
+		} else {
+			writeAudit(auditEntry{Operation: auditCreate, ReceiptID: id, Tenant: tenant})
+		}
+
+		out, err := json.Marshal(queuedPoints{ID: id, Points: pointTotal})
+		if err != nil {
+			log.Printf("queue: unable to encode points for %s: %v", id, err)
+			return
+		}
+		if err := queue.Publish(outSubject, out); err != nil {
+			log.Printf("queue: unable to publish points for %s: %v", id, err)
+		}
+	})
+}
+
+// memoryQueueSize is how many unread messages a memoryQueue subject buffers before dropping new ones
+const memoryQueueSize = 100
+
+// errQueueFull is returned by memoryQueue.Publish when the subject's buffer is full
+var errQueueFull = errors.New("queue is full")
+
+// memoryQueue is an in-process messageQueue backed by channels, for embedding and tests
+type memoryQueue struct {
+	mu       sync.Mutex
+	subjects map[string]chan []byte
+}
+
+// newMemoryQueue creates an empty in-process queue
+func newMemoryQueue() *memoryQueue {
+	return &memoryQueue{subjects: make(map[string]chan []byte)}
+}
+
+// channel returns the buffered channel for a subject, creating it on first use
+func (q *memoryQueue) channel(subject string) chan []byte {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ch, ok := q.subjects[subject]
+	if !ok {
+		ch = make(chan []byte, memoryQueueSize)
+		q.subjects[subject] = ch
+	}
+	return ch
+}
+
+// Publish enqueues a message on the subject without blocking, dropping it with errQueueFull when
+// memoryQueueSize messages are already waiting, e.g. on an output subject nobody reads
+func (q *memoryQueue) Publish(subject string, body []byte) error {
+	select {
+	case q.channel(subject) <- body:
+		return nil
+	default:
+		return errQueueFull
+	}
+}
+
+// Subscribe delivers messages on the subject to handle until ctx is done
+func (q *memoryQueue) Subscribe(ctx context.Context, subject string, handle func(body []byte)) error {
+	ch := q.channel(subject)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case body := <-ch:
+			handle(body)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// nextMessage waits for the next message published on a memory queue subject
+func nextMessage(t *testing.T, queue *memoryQueue, subject string) []byte {
+	t.Helper()
+	select {
+	case body := <-queue.channel(subject):
+		return body
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no message published on %s", subject)
+		return nil
+	}
+}
+
+func TestConsumeReceipts(t *testing.T) {
+	resetState(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	queue := newMemoryQueue()
+	go consumeReceipts(ctx, queue, "receipts", "points", defaultTenant)
+
+	// an invalid receipt is dropped without emitting points, so the next points message is the valid one's
+	queue.Publish("receipts", []byte(`{"retailer": ""}`))
+	queue.Publish("receipts", []byte(targetReceipt))
+
+	var points queuedPoints
+	if err := json.Unmarshal(nextMessage(t, queue, "points"), &points); err != nil {
+		t.Fatal(err)
+	}
+	if points.Points != 28 {
+		t.Errorf("published points = %d, want 28", points.Points)
+	}
+
+	stored, ok := store.get(points.ID)
+	if !ok {
+		t.Fatalf("published receipt %s is not in the store", points.ID)
+	}
+	if stored.Retailer != "Target" || stored.Points != 28 {
+		t.Errorf("stored receipt = %s with %d points, want Target with 28", stored.Retailer, stored.Points)
+	}
+	if count := len(store.list()); count != 1 {
+		t.Errorf("store holds %d receipts, want 1", count)
+	}
+}
+
+func TestStartQueueConsumerRequiresBackend(t *testing.T) {
+	resetState(t)
+	ingestQueue = nil
+	startQueueConsumer(context.Background(), appSettings)
+	if ingestQueue != nil {
+		t.Error("consumer started without QUEUE_BACKEND")
+	}
+}
+
+func TestMemoryQueuePublishDoesNotBlock(t *testing.T) {
+	queue := newMemoryQueue()
+	for i := 0; i < memoryQueueSize; i++ {
+		if err := queue.Publish("unread", []byte("{}")); err != nil {
+			t.Fatalf("publish %d: %v", i, err)
+		}
+	}
+	if err := queue.Publish("unread", []byte("{}")); err != errQueueFull {
+		t.Errorf("publish past the buffer = %v, want errQueueFull", err)
+	}
+}
+
+func TestConsumeReceiptsWithUnreadPoints(t *testing.T) {
+	resetState(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	// stop the consumer before resetState's cleanup, since it's still handling the last receipt
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	// nothing reads the points subject, so most points messages are dropped, but every receipt is still stored
+	const receipts = memoryQueueSize + 50
+	queue := newMemoryQueue()
+	go func() {
+		consumeReceipts(ctx, queue, "receipts", "points", defaultTenant)
+		close(stopped)
+	}()
+	for i := 0; i < receipts; {
+		if queue.Publish("receipts", []byte(targetReceipt)) == nil {
+			i++
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for store.len() < receipts {
+		if time.Now().After(deadline) {
+			t.Fatalf("consumer stalled at %d of %d receipts", store.len(), receipts)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestQueueBackendSetting(t *testing.T) {
+	t.Setenv("QUEUE_BACKEND", "memory")
+	if _, err := loadSettings(); err == nil {
+		t.Error("accepted QUEUE_BACKEND=memory, which nothing in the server publishes to")
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReceiptParser extracts a structured receipt from raw (e.g. OCR'd) receipt text
+type ReceiptParser interface {
+	Parse(text string) (receipt, error)
+}
+
+// receiptParser is the parser used by processRawReceipt
+var receiptParser ReceiptParser = regexReceiptParser{}
+
+// regexReceiptParser is a simple line-based ReceiptParser. It expects the retailer on the first line,
+// "Date:", "Time:" and "Total:" lines, and items as a description followed by a price, e.g.
+//
+//	Target
+//	Date: 2022-01-01
+//	Time: 13:01
+//	Mountain Dew 12PK   6.49
+//	Total: 6.49
+type regexReceiptParser struct{}
+
+// patterns recognized by regexReceiptParser
+var (
+	rawDatePattern  = regexp.MustCompile(`(?i)^date:\s*(\S+)$`)
+	rawTimePattern  = regexp.MustCompile(`(?i)^time:\s*(\S+)$`)
+	rawTotalPattern = regexp.MustCompile(`(?i)^total:\s*\$?(\d+(?:\.\d+)?)$`)
+	rawItemPattern  = regexp.MustCompile(`^(.+?)\s+\$?(\d+\.\d{2})$`)
+)
+
+// Parse extracts the retailer, date, time, items and total from the text
+func (regexReceiptParser) Parse(text string) (receipt, error) {
+	var parsed receipt
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		switch {
+		case parsed.Retailer == "":
+			parsed.Retailer = line
+		case rawDatePattern.MatchString(line):
+			parsed.PurchaseDate = rawDatePattern.FindStringSubmatch(line)[1]
+		case rawTimePattern.MatchString(line):
+			parsed.PurchaseTime = rawTimePattern.FindStringSubmatch(line)[1]
+		case rawTotalPattern.MatchString(line):
+			parsed.Total = rawTotalPattern.FindStringSubmatch(line)[1]
+		case rawItemPattern.MatchString(line):
+			match := rawItemPattern.FindStringSubmatch(line)
+			parsed.Items = append(parsed.Items, item{ShortDescription: match[1], Price: match[2]})
+		}
+	}
+
+	if parsed.Retailer == "" || parsed.Total == "" {
+		return parsed, errors.New("unable to find a retailer and total in the receipt text")
+	}
+	return parsed, nil
+}
+
+// processRawReceipt takes in raw receipt text (base64-encoded when ?encoding=base64), parses it into a receipt,
+// then validates and stores it like processReceipt, returning the generated ID
+func processRawReceipt(context *gin.Context) {
+	body, err := io.ReadAll(context.Request.Body)
+	if err != nil {
+		respondError(context, http.StatusBadRequest, "The receipt is invalid", nil)
+		return
+	}
+
+	text := string(body)
+	if context.Query("encoding") == "base64" {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+		if err != nil {
+			respondError(context, http.StatusBadRequest, "The receipt is invalid", gin.H{"error": "body is not valid base64"})
+			return
+		}
+		text = string(decoded)
+	}
+
+	newReceipt, err := receiptParser.Parse(text)
+	if err != nil {
+		respondError(context, http.StatusBadRequest, "The receipt is invalid", gin.H{"error": err.Error()})
+		return
+	}
+	// raw text has no currency, so treat it as the original schema
+	applyDefaults(&newReceipt, schemaV1, appSettings)
+	if err := migrateReceipt(&newReceipt, schemaV1); err != nil {
+		respondError(context, http.StatusBadRequest, "The receipt is invalid", gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateReceipt(&newReceipt, appSettings); err != nil {
+		respondError(context, http.StatusBadRequest, "The receipt is invalid", gin.H{"error": err.Error()})
+		return
+	}
+
+	id, merged := addOrMergeReceipt(tenantWriteStore(context), newReceipt)
+	if !merged {
+		recordAudit(context, auditCreate, id)
+	}
+	context.Header("Location", "/receipts/"+id+"/points")
+	respondJSON(context, http.StatusOK, returnID{ID: id})
+}
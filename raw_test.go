@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rawTargetReceipt is the spec's Target example written out as receipt text
+const rawTargetReceipt = `Target
+Date: 2022-01-01
+Time: 13:01
+Mountain Dew 12PK   6.49
+Emils Cheese Pizza   12.25
+Knorr Creamy Chicken   1.26
+Doritos Nacho Cheese   3.35
+Klarbrunn 12-PK 12 FL OZ   $12.00
+Total: $35.35
+`
+
+func TestRegexReceiptParser(t *testing.T) {
+	parsed, err := regexReceiptParser{}.Parse(rawTargetReceipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Items: []item{
+			{ShortDescription: "Mountain Dew 12PK", Price: "6.49"},
+			{ShortDescription: "Emils Cheese Pizza", Price: "12.25"},
+			{ShortDescription: "Knorr Creamy Chicken", Price: "1.26"},
+			{ShortDescription: "Doritos Nacho Cheese", Price: "3.35"},
+			{ShortDescription: "Klarbrunn 12-PK 12 FL OZ", Price: "12.00"},
+		},
+		Total: "35.35",
+	}
+	if !reflect.DeepEqual(parsed, want) {
+		t.Errorf("Parse = %+v, want %+v", parsed, want)
+	}
+
+	if _, err := (regexReceiptParser{}).Parse("Date: 2022-01-01\n"); err == nil {
+		t.Error("Parse accepted text without a total")
+	}
+}
+
+func TestProcessRawReceipt(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		body string
+	}{
+		{"plain", "/receipts/process/raw", rawTargetReceipt},
+		{"base64", "/receipts/process/raw?encoding=base64", base64.StdEncoding.EncodeToString([]byte(rawTargetReceipt))},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetState(t)
+			recorder := doRequest(t, http.MethodPost, test.path, test.body)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("raw process returned %d: %s", recorder.Code, recorder.Body.String())
+			}
+			var id returnID
+			decodeBody(t, recorder, &id)
+			if points := testPoints(t, id.ID); points != 28 {
+				t.Errorf("points = %d, want 28", points)
+			}
+		})
+	}
+}
+
+func TestProcessRawReceiptDuplicateWindow(t *testing.T) {
+	resetState(t)
+	appSettings.DuplicateWindow = time.Minute
+	fixedNow(t, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	first := processTestReceipt(t, targetReceipt)
+
+	// same retailer, date and total as the JSON receipt, so it's a double submission within the window
+	body := strings.Replace(rawTargetReceipt, "Mountain Dew 12PK", "Pepsi 12PK", 1)
+	recorder := doRequest(t, http.MethodPost, "/receipts/process/raw", body)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("raw process returned %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var id returnID
+	decodeBody(t, recorder, &id)
+	if id.ID != first || len(store.list()) != 1 {
+		t.Errorf("raw double submission got ID %s with %d stored receipts, want %s and 1", id.ID, len(store.list()), first)
+	}
+}
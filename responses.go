@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// problemContentType is the RFC 7807 media type for problem details
+const problemContentType = "application/problem+json"
+
+// respondError writes an error response with the given status and human-readable detail.
+// By default the body is {"message": detail} plus any extra fields; when PROBLEM_JSON is set or the
+// client accepts application/problem+json, it is an RFC 7807 problem object with the extras as members.
+func respondError(context *gin.Context, status int, detail string, extra gin.H) {
+	if appSettings.ProblemJSON || strings.Contains(context.GetHeader("Accept"), problemContentType) {
+		problem := gin.H{
+			"type":   "about:blank",
+			"title":  http.StatusText(status),
+			"status": status,
+			"detail": detail,
+		}
+		for key, value := range extra {
+			if _, reserved := problem[key]; !reserved {
+				problem[key] = value
+			}
+		}
+
+		// gin keeps an existing Content-Type when rendering JSON
+		context.Header("Content-Type", problemContentType)
+		context.IndentedJSON(status, problem)
+		return
+	}
+
+	body := gin.H{"message": detail}
+	for key, value := range extra {
+		body[key] = value
+	}
+	context.IndentedJSON(status, body)
+}
+
+// abortWithError writes an error response like respondError and stops the remaining handlers
+func abortWithError(context *gin.Context, status int, detail string, extra gin.H) {
+	respondError(context, status, detail, extra)
+	context.Abort()
+}
+
+// responseMeta is the request metadata included in enveloped responses
+type responseMeta struct {
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// respondJSON writes a successful JSON response. When RESPONSE_ENVELOPE is set the body is wrapped as
+// {"data": body, "meta": {...}}; otherwise it is written bare.
+func respondJSON(context *gin.Context, status int, body any) {
+	if !appSettings.ResponseEnvelope {
+		context.IndentedJSON(status, body)
+		return
+	}
+
+	context.IndentedJSON(status, gin.H{
+		"data": body,
+		"meta": responseMeta{
+			Method:    context.Request.Method,
+			Path:      context.Request.URL.Path,
+			Timestamp: now().UTC(),
+		},
+	})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestProblemJSONErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		setting bool
+		accept  string
+		status  int
+	}{
+		{"400 via setting", http.MethodPost, "/receipts/process", `{"retailer": ""}`, true, "", http.StatusBadRequest},
+		{"404 via setting", http.MethodGet, "/receipts/3f2504e0-4f89-41d3-9a0c-0305e82c3301/points", "", true, "", http.StatusNotFound},
+		{"400 via Accept", http.MethodPost, "/receipts/process", `{"retailer": ""}`, false, problemContentType, http.StatusBadRequest},
+		{"404 via Accept", http.MethodGet, "/receipts/3f2504e0-4f89-41d3-9a0c-0305e82c3301/points", "", false, problemContentType, http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetState(t)
+			appSettings.ProblemJSON = test.setting
+			recorder := doRequest(t, test.method, test.path, test.body, "Accept", test.accept)
+			if recorder.Code != test.status {
+				t.Fatalf("returned %d, want %d", recorder.Code, test.status)
+			}
+			if contentType := recorder.Header().Get("Content-Type"); contentType != problemContentType {
+				t.Errorf("Content-Type = %q, want %s", contentType, problemContentType)
+			}
+
+			var problem struct {
+				Type   string `json:"type"`
+				Title  string `json:"title"`
+				Status int    `json:"status"`
+				Detail string `json:"detail"`
+			}
+			decodeBody(t, recorder, &problem)
+			if problem.Type != "about:blank" || problem.Title != http.StatusText(test.status) ||
+				problem.Status != test.status || problem.Detail == "" {
+				t.Errorf("problem = %+v, want type, title, status %d and detail", problem, test.status)
+			}
+		})
+	}
+}
+
+func TestPlainErrorsByDefault(t *testing.T) {
+	resetState(t)
+	recorder := doRequest(t, http.MethodPost, "/receipts/process", `{"retailer": ""}`)
+	if contentType := recorder.Header().Get("Content-Type"); contentType == problemContentType {
+		t.Errorf("Content-Type = %q without problem+json being requested", contentType)
+	}
+	var body map[string]interface{}
+	decodeBody(t, recorder, &body)
+	if _, ok := body["message"]; !ok {
+		t.Errorf("error body %v has no message", body)
+	}
+}
+
+func TestResponseEnvelope(t *testing.T) {
+	resetState(t)
+	id := processTestReceipt(t, targetReceipt)
+	path := "/receipts/" + id + "/points"
+
+	var bare map[string]interface{}
+	decodeBody(t, doRequest(t, http.MethodGet, path, ""), &bare)
+	if bare["points"] != float64(28) || bare["data"] != nil {
+		t.Errorf("bare response = %v, want {points: 28}", bare)
+	}
+
+	appSettings.ResponseEnvelope = true
+	var enveloped struct {
+		Data returnPoints `json:"data"`
+		Meta responseMeta `json:"meta"`
+	}
+	decodeBody(t, doRequest(t, http.MethodGet, path, ""), &enveloped)
+	if enveloped.Data.Points != 28 {
+		t.Errorf("enveloped points = %d, want 28", enveloped.Data.Points)
+	}
+	if enveloped.Meta.Method != http.MethodGet || enveloped.Meta.Path != path || enveloped.Meta.Timestamp.IsZero() {
+		t.Errorf("meta = %+v, want GET %s with a timestamp", enveloped.Meta, path)
+	}
+}
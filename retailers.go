@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// retailerCount represents a distinct retailer name and how many stored receipts it appears on
+type retailerCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// distinctRetailers returns the sorted, de-duplicated retailer names across the receipts, skipping deleted ones.
+// When caseFold is set, names differing only by case are merged under the first spelling seen.
+func distinctRetailers(receipts []receipt, caseFold bool) []retailerCount {
+	index := map[string]int{}
+	retailers := []retailerCount{}
+
+	for _, r := range receipts {
+		if r.DeletedAt != nil {
+			continue
+		}
+		key := r.Retailer
+		if caseFold {
+			key = strings.ToLower(key)
+		}
+
+		if i, ok := index[key]; ok {
+			retailers[i].Count++
+			continue
+		}
+		index[key] = len(retailers)
+		retailers = append(retailers, retailerCount{Name: r.Retailer, Count: 1})
+	}
+
+	sort.Slice(retailers, func(i, j int) bool {
+		return retailers[i].Name < retailers[j].Name
+	})
+	return retailers
+}
+
+// getRetailers sends the sorted list of distinct retailer names, with per-retailer receipt counts if ?counts=true
+func getRetailers(context *gin.Context) {
+	retailers := distinctRetailers(tenantStore(context).list(), appSettings.RetailerCaseFold)
+
+	if context.Query("counts") == "true" {
+		respondJSON(context, http.StatusOK, gin.H{"retailers": retailers})
+		return
+	}
+
+	names := make([]string, 0, len(retailers))
+	for _, retailer := range retailers {
+		names = append(names, retailer.Name)
+	}
+	respondJSON(context, http.StatusOK, gin.H{"retailers": names})
+}
+
+// returnRetailerPoints represents the total points across a retailer's receipts
+type returnRetailerPoints struct {
+	Retailer string `json:"retailer"`
+	Receipts int    `json:"receipts"`
+	Points   int    `json:"points"`
+}
+
+// getRetailerPoints sends the total points across every receipt from the named retailer (case-insensitive),
+// scoring receipts that haven't been scored yet. Unknown retailers have zero points, and receipts that can't
+// be scored are left out.
+func getRetailerPoints(context *gin.Context) {
+	scoped := tenantStore(context)
+	total := returnRetailerPoints{Retailer: context.Param("name")}
+	for _, r := range scoped.retailerReceipts(total.Retailer) {
+		if r.DeletedAt != nil {
+			continue
+		}
+		points, err := requestPoints(context, &r)
+		if err != nil {
+			continue
+		}
+		total.Receipts++
+		total.Points += points
+	}
+
+	respondJSON(context, http.StatusOK, total)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestDistinctRetailers(t *testing.T) {
+	receipts := []receipt{
+		{Retailer: "Target"}, {Retailer: "Walgreens"}, {Retailer: "TARGET"}, {Retailer: "Target"}, {Retailer: "Costco"},
+	}
+
+	tests := []struct {
+		name     string
+		caseFold bool
+		want     []retailerCount
+	}{
+		{"case folded", true, []retailerCount{{"Costco", 1}, {"Target", 3}, {"Walgreens", 1}}},
+		{"case sensitive", false, []retailerCount{{"Costco", 1}, {"TARGET", 1}, {"Target", 2}, {"Walgreens", 1}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := distinctRetailers(receipts, test.caseFold); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("distinctRetailers = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGetRetailers(t *testing.T) {
+	resetState(t)
+	processTestReceipt(t, targetReceipt)
+	processTestReceipt(t, cornerMarketReceipt)
+	processTestReceipt(t, withFields(t, targetReceipt, map[string]interface{}{"retailer": "target"}))
+
+	var names struct {
+		Retailers []string `json:"retailers"`
+	}
+	decodeBody(t, doRequest(t, http.MethodGet, "/retailers", ""), &names)
+	if want := []string{"M&M Corner Market", "Target"}; !reflect.DeepEqual(names.Retailers, want) {
+		t.Errorf("retailers = %v, want %v", names.Retailers, want)
+	}
+
+	var counts struct {
+		Retailers []retailerCount `json:"retailers"`
+	}
+	decodeBody(t, doRequest(t, http.MethodGet, "/retailers?counts=true", ""), &counts)
+	if want := []retailerCount{{"M&M Corner Market", 1}, {"Target", 2}}; !reflect.DeepEqual(counts.Retailers, want) {
+		t.Errorf("retailer counts = %+v, want %+v", counts.Retailers, want)
+	}
+}
+
+func TestGetRetailerPoints(t *testing.T) {
+	resetState(t)
+	processTestReceipt(t, targetReceipt)
+	processTestReceipt(t, cornerMarketReceipt)
+	processTestReceipt(t, withFields(t, targetReceipt, map[string]interface{}{"retailer": "TARGET"}))
+
+	tests := []struct {
+		name string
+		want returnRetailerPoints
+	}{
+		{"target", returnRetailerPoints{Retailer: "target", Receipts: 2, Points: 56}},
+		{"M&M Corner Market", returnRetailerPoints{Retailer: "M&M Corner Market", Receipts: 1, Points: 109}},
+		{"Costco", returnRetailerPoints{Retailer: "Costco", Receipts: 0, Points: 0}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := doRequest(t, http.MethodGet, "/retailers/"+url.PathEscape(test.name)+"/points", "")
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("retailer points returned %d: %s", recorder.Code, recorder.Body.String())
+			}
+			var got returnRetailerPoints
+			decodeBody(t, recorder, &got)
+			if got != test.want {
+				t.Errorf("retailer points = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// receipt schema versions clients can declare with the X-Receipt-Schema header or a schemaVersion field
+const (
+	schemaV1 = 1 // the original receipt, priced in an implied currency
+	schemaV2 = 2 // adds a required ISO 4217 currency code
+
+	currentSchemaVersion = schemaV2
+)
+
+// defaultCurrency is assigned to receipts submitted in a schema that predates the currency field
+const defaultCurrency = "USD"
+
+// currencyPattern matches an ISO 4217 alphabetic currency code such as "USD"
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// receiptSchema checks a receipt against the rules of the version it was declared in and upgrades it to the
+// next version; receipts are migrated one version at a time until they reach currentSchemaVersion
+type receiptSchema struct {
+	Validate func(r *receipt) error
+	Upgrade  func(r *receipt)
+}
+
+// receiptSchemas maps each supported schema version to its validator and upgrade step
+var receiptSchemas = map[int]receiptSchema{
+	schemaV1: {
+		Validate: func(r *receipt) error {
+			if r.Currency != "" {
+				return errors.New("currency requires schema version 2")
+			}
+			return nil
+		},
+		Upgrade: func(r *receipt) { r.Currency = defaultCurrency },
+	},
+	schemaV2: {
+		Validate: func(r *receipt) error {
+			if !currencyPattern.MatchString(r.Currency) {
+				return errors.New("currency must be a 3-letter ISO 4217 code, e.g. USD")
+			}
+			return nil
+		},
+	},
+}
+
+// applyDefaults fills in a missing purchaseTime or currency from the configured defaults in lenient mode.
+// Only receipts declared in a schema with the currency field are given the default currency; older ones
+// are assigned defaultCurrency when they're migrated.
+func applyDefaults(r *receipt, version int, settings settings) {
+	if !settings.LenientParsing {
+		return
+	}
+	if settings.DefaultPurchaseTime != "" && strings.TrimSpace(r.PurchaseTime) == "" {
+		r.PurchaseTime = settings.DefaultPurchaseTime
+	}
+	if settings.DefaultCurrency != "" && r.Currency == "" && version >= schemaV2 {
+		r.Currency = settings.DefaultCurrency
+	}
+}
+
+// declaredSchemaVersion returns the schema version a receipt was sent in, from the X-Receipt-Schema header
+// or the body's schemaVersion field, defaulting to v1 for clients that declare neither
+func declaredSchemaVersion(header string, r *receipt) (int, error) {
+	version := r.SchemaVersion
+	if header != "" {
+		headerVersion, err := strconv.Atoi(header)
+		if err != nil {
+			return 0, errors.New("X-Receipt-Schema must be a schema version number")
+		}
+		if version != 0 && version != headerVersion {
+			return 0, errors.New("X-Receipt-Schema and schemaVersion disagree")
+		}
+		version = headerVersion
+	}
+	if version == 0 {
+		version = schemaV1
+	}
+	if _, ok := receiptSchemas[version]; !ok {
+		return 0, errors.New("unsupported schema version " + strconv.Itoa(version))
+	}
+	return version, nil
+}
+
+// migrateReceipt validates a receipt against its declared schema version and upgrades it to the current one
+func migrateReceipt(r *receipt, version int) error {
+	for ; version < currentSchemaVersion; version++ {
+		schema := receiptSchemas[version]
+		if err := schema.Validate(r); err != nil {
+			return err
+		}
+		schema.Upgrade(r)
+	}
+	if err := receiptSchemas[currentSchemaVersion].Validate(r); err != nil {
+		return err
+	}
+	r.SchemaVersion = currentSchemaVersion
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSchemaVersions(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		fields   map[string]interface{}
+		status   int
+		currency string
+	}{
+		{"undeclared is v1", "", nil, http.StatusOK, defaultCurrency},
+		{"v1 header", "1", nil, http.StatusOK, defaultCurrency},
+		{"v1 field", "", map[string]interface{}{"schemaVersion": 1}, http.StatusOK, defaultCurrency},
+		{"v1 with a currency", "1", map[string]interface{}{"currency": "EUR"}, http.StatusBadRequest, ""},
+		{"v2 header", "2", map[string]interface{}{"currency": "EUR"}, http.StatusOK, "EUR"},
+		{"v2 field", "", map[string]interface{}{"schemaVersion": 2, "currency": "CAD"}, http.StatusOK, "CAD"},
+		{"v2 without a currency", "2", nil, http.StatusBadRequest, ""},
+		{"v2 with a bad currency", "2", map[string]interface{}{"currency": "usd"}, http.StatusBadRequest, ""},
+		{"header and field disagree", "1", map[string]interface{}{"schemaVersion": 2, "currency": "EUR"}, http.StatusBadRequest, ""},
+		{"unsupported version", "3", nil, http.StatusBadRequest, ""},
+		{"non-numeric header", "v2", nil, http.StatusBadRequest, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetState(t)
+			body := targetReceipt
+			if test.fields != nil {
+				body = withFields(t, body, test.fields)
+			}
+			recorder := doRequest(t, http.MethodPost, "/receipts/process", body, "X-Receipt-Schema", test.header)
+			if recorder.Code != test.status {
+				t.Fatalf("process returned %d, want %d: %s", recorder.Code, test.status, recorder.Body.String())
+			}
+			if test.status != http.StatusOK {
+				return
+			}
+
+			var id returnID
+			decodeBody(t, recorder, &id)
+			stored, _ := store.get(id.ID)
+			if stored.SchemaVersion != currentSchemaVersion || stored.Currency != test.currency {
+				t.Errorf("stored schema %d currency %q, want %d %q", stored.SchemaVersion, stored.Currency, currentSchemaVersion, test.currency)
+			}
+			if points := testPoints(t, id.ID); points != 28 {
+				t.Errorf("points = %d, want 28", points)
+			}
+		})
+	}
+}
+
+func TestLenientDefaults(t *testing.T) {
+	withoutTime := withFields(t, targetReceipt, map[string]interface{}{"purchaseTime": ""})
+	withoutCurrency := withFields(t, targetReceipt, map[string]interface{}{"schemaVersion": 2})
+
+	tests := []struct {
+		name         string
+		lenient      bool
+		body         string
+		status       int
+		wantTime     string
+		wantCurrency string
+		points       int
+	}{
+		// the default time falls in the afternoon window, adding 10 points to the Target example's 28
+		{"missing time", true, withoutTime, http.StatusOK, "14:30", defaultCurrency, 38},
+		{"missing time when strict", false, withoutTime, http.StatusBadRequest, "", "", 0},
+		{"missing v2 currency", true, withoutCurrency, http.StatusOK, "13:01", "EUR", 28},
+		{"missing v2 currency when strict", false, withoutCurrency, http.StatusBadRequest, "", "", 0},
+		{"v1 receipt keeps the migration default", true, targetReceipt, http.StatusOK, "13:01", defaultCurrency, 28},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetState(t)
+			appSettings.LenientParsing = test.lenient
+			appSettings.DefaultPurchaseTime = "14:30"
+			appSettings.DefaultCurrency = "EUR"
+			recorder := doRequest(t, http.MethodPost, "/receipts/process", test.body)
+			if recorder.Code != test.status {
+				t.Fatalf("process returned %d, want %d: %s", recorder.Code, test.status, recorder.Body.String())
+			}
+			if test.status != http.StatusOK {
+				return
+			}
+
+			var id returnID
+			decodeBody(t, recorder, &id)
+			stored, _ := store.get(id.ID)
+			if stored.PurchaseTime != test.wantTime || stored.Currency != test.wantCurrency {
+				t.Errorf("stored time %q currency %q, want %q %q", stored.PurchaseTime, stored.Currency, test.wantTime, test.wantCurrency)
+			}
+			if points := testPoints(t, id.ID); points != test.points {
+				t.Errorf("points = %d, want %d", points, test.points)
+			}
+		})
+	}
+}
@@ -0,0 +1,1084 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ScoringConfig holds the tunable point values used by the scoring rules
+type ScoringConfig struct {
+	RetailerLetterPoints  int     `json:"retailerLetterPoints"`
+	RetailerDigitPoints   int     `json:"retailerDigitPoints"`
+	RetailerPointsCap     int     `json:"retailerPointsCap"` // maximum retailer name points, 0 means uncapped
+	RoundDollarPoints     int     `json:"roundDollarPoints"`
+	QuarterMultiplePoints int     `json:"quarterMultiplePoints"`
+	QuarterEpsilon        float64 `json:"quarterEpsilon"` // tolerance for float error when checking multiples of 0.25
+	ItemPairPoints        int     `json:"itemPairPoints"`
+	OddDayPoints          int     `json:"oddDayPoints"`
+	AfternoonPoints       int     `json:"afternoonPoints"`
+
+	// ItemCountTiers, when set, replace the flat ItemPairPoints rule: a receipt earns the bonus of the
+	// highest tier whose MinItems it reaches, e.g. 2 items=5, 5 items=15, 10 items=40
+	ItemCountTiers []itemCountTier `json:"itemCountTiers"`
+
+	// PairPriceFactor, when set, replaces the flat ItemPairPoints rule with each pair earning
+	// round(average item price in dollars * factor); ItemCountTiers take precedence over it
+	PairPriceFactor float64 `json:"pairPriceFactor"`
+
+	// ItemPriceMultiplier scales the price of each item whose trimmed description length is a multiple of 3.
+	// Each item's points are rounded up to ItemPriceRoundingStep, or, when ItemPriceRoundAtEnd is set,
+	// the unrounded points are summed and only the final rule total is rounded up to the step.
+	ItemPriceMultiplier   float64 `json:"itemPriceMultiplier"`
+	ItemPriceRoundingStep float64 `json:"itemPriceRoundingStep"`
+	ItemPriceRoundAtEnd   bool    `json:"itemPriceRoundAtEnd"`
+
+	// CentsModulusPoints is awarded when the cents part of the total is a multiple of CentsModulus,
+	// e.g. 10 for totals ending in a whole dime (0 for either disables the rule)
+	CentsModulus       int64 `json:"centsModulus"`
+	CentsModulusPoints int   `json:"centsModulusPoints"`
+
+	// LogTotalCoefficient awards floor(k * ln(total)) points, a diminishing-returns reward for larger totals
+	LogTotalCoefficient float64 `json:"logTotalCoefficient"`
+
+	// TotalDigitPoints is awarded per digit in the total written with two decimals, e.g. 6 digits for
+	// "1299.50" (0 disables the rule)
+	TotalDigitPoints int `json:"totalDigitPoints"`
+
+	// TopOfHourPoints is awarded when the purchase time's minutes are 00, e.g. 14:00 (0 disables the rule)
+	TopOfHourPoints int `json:"topOfHourPoints"`
+
+	// PointsPerDollar is awarded for every whole dollar of the total, e.g. 35 points for $35.99 at 1 (0 disables the rule)
+	PointsPerDollar int `json:"pointsPerDollar"`
+
+	// LargePurchaseBonus is awarded when the total is at least LargePurchaseThresholdCents (0 disables the rule)
+	LargePurchaseThresholdCents int64 `json:"largePurchaseThresholdCents"`
+	LargePurchaseBonus          int   `json:"largePurchaseBonus"`
+
+	// EvenRetailerNamePoints is awarded when the retailer name has an even number of alphanumeric characters
+	// (0 disables the rule)
+	EvenRetailerNamePoints int `json:"evenRetailerNamePoints"`
+
+	// UniqueDescriptionPoints is awarded per distinct item description (trimmed, case-insensitive), so duplicate
+	// line items earn nothing extra (0 disables the rule)
+	UniqueDescriptionPoints int `json:"uniqueDescriptionPoints"`
+
+	// PremiumPurchaseBonus is awarded when every item is priced at or above PremiumItemPriceCents
+	// (0 disables the rule; a receipt with no items never qualifies)
+	PremiumItemPriceCents int64 `json:"premiumItemPriceCents"`
+	PremiumPurchaseBonus  int   `json:"premiumPurchaseBonus"`
+
+	// OddItemCountPoints is awarded when the receipt has an odd number of items (0 disables the rule)
+	OddItemCountPoints int `json:"oddItemCountPoints"`
+
+	// WeekendPoints is awarded when the purchase date falls on a Saturday or Sunday (0 disables the rule)
+	WeekendPoints int `json:"weekendPoints"`
+
+	// PromoWindows award a bonus to receipts purchased within an inclusive ISO date range.
+	// PromoOverlap decides how overlapping windows combine: "sum" (default) or "max".
+	PromoWindows []promoWindow `json:"promoWindows"`
+	PromoOverlap string        `json:"promoOverlap"`
+
+	// AllowedRetailers, when non-empty, limits scoring to those retailers; DeniedRetailers are always excluded.
+	// Both match case-insensitively. NonParticipatingAction is "zero" (default) to score a non-participating
+	// retailer's receipts as 0, or "reject" to refuse them at process time.
+	AllowedRetailers       []string `json:"allowedRetailers"`
+	DeniedRetailers        []string `json:"deniedRetailers"`
+	NonParticipatingAction string   `json:"nonParticipatingAction"`
+
+	// MinimumTotalCents is the smallest total eligible for points; receipts below it score 0 (0 means no minimum)
+	MinimumTotalCents int64 `json:"minimumTotalCents"`
+
+	// FirstOfMonthPoints is awarded to a retailer's earliest receipt in each calendar month (0 disables the rule)
+	FirstOfMonthPoints int `json:"firstOfMonthPoints"`
+
+	// StreakBonus is awarded when the retailer has receipts on each of the StreakDays (default 3) consecutive
+	// days ending on this receipt's purchase date (0 disables the rule)
+	StreakBonus int `json:"streakBonus"`
+	StreakDays  int `json:"streakDays"`
+
+	// SameDayRepeatFactor gives diminishing returns for repeat visits: the total is multiplied by the factor
+	// once for every receipt the same retailer already has on the same day (0 disables the adjustment)
+	SameDayRepeatFactor float64 `json:"sameDayRepeatFactor"`
+
+	// AgeDecayFactor multiplies the total once for every AgeDecayPeriodDays (default 1) that have passed between
+	// the purchase date and the day the receipt is scored, e.g. 0.9 with a 7-day period loses 10% a week
+	// (0 disables the adjustment)
+	AgeDecayFactor     float64 `json:"ageDecayFactor"`
+	AgeDecayPeriodDays int     `json:"ageDecayPeriodDays"`
+
+	// RetailerMultipliers scale the total for partner retailers, matched case-insensitively (unlisted retailers get 1.0)
+	RetailerMultipliers retailerMultipliers `json:"retailerMultipliers"`
+
+	// MissingTimePenalty is deducted (without going below zero) from receipts accepted without a purchaseTime,
+	// which is only possible in lenient parsing mode
+	MissingTimePenalty int `json:"missingTimePenalty"`
+
+	// RoundTotalPenalty is deducted (without going below zero) from receipts whose total is an exact multiple of
+	// RoundTotalModulusCents (10000, i.e. $100.00, by default), which can indicate a made-up receipt
+	// (0 disables the adjustment)
+	RoundTotalPenalty      int   `json:"roundTotalPenalty"`
+	RoundTotalModulusCents int64 `json:"roundTotalModulusCents"`
+
+	// FinalRoundingStep rounds the final point total to the nearest multiple, e.g. 5 or 10 (0 disables rounding)
+	FinalRoundingStep int `json:"finalRoundingStep"`
+
+	// MaxPoints caps the points any single receipt can earn (0 means uncapped)
+	MaxPoints int `json:"maxPoints"`
+
+	// Tiers maps point thresholds to reward tier names; a receipt lands in the highest tier whose MinPoints it reaches
+	Tiers []rewardTier `json:"tiers"`
+
+	// DisabledRules lists rules by name (e.g. "roundDollar") that calculatePoints should skip
+	DisabledRules map[string]bool `json:"disabledRules"`
+
+	// CompositeRules award a bonus when all of their conditions hold (none by default)
+	CompositeRules []compositeRule `json:"compositeRules"`
+
+	// CategoryBonuses maps an item category to the bonus points awarded per item in that category
+	CategoryBonuses map[string]int `json:"categoryBonuses"`
+
+	// KeywordBonuses maps a keyword to the bonus points awarded per item whose description contains it
+	// (case-insensitive); an item containing several keywords earns each of their bonuses
+	KeywordBonuses map[string]int `json:"keywordBonuses"`
+}
+
+// defaultScoringConfig returns the scoring config matching the original receipt processor rules
+func defaultScoringConfig() ScoringConfig {
+	return ScoringConfig{
+		RetailerLetterPoints:  1,
+		RetailerDigitPoints:   1,
+		RoundDollarPoints:     50,
+		QuarterMultiplePoints: 25,
+		ItemPairPoints:        5,
+		OddDayPoints:          6,
+		AfternoonPoints:       10,
+		ItemPriceMultiplier:   .2,
+		ItemPriceRoundingStep: 1,
+		Tiers: []rewardTier{
+			{Name: "bronze", MinPoints: 0},
+			{Name: "silver", MinPoints: 50},
+			{Name: "gold", MinPoints: 100},
+		},
+	}
+}
+
+// promoWindow is a limited-time promotion awarding Bonus to purchases from Start through End (YYYY-MM-DD)
+type promoWindow struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+	Bonus int    `json:"bonus"`
+}
+
+// itemCountTier awards Bonus to receipts with at least MinItems items
+type itemCountTier struct {
+	MinItems int `json:"minItems"`
+	Bonus    int `json:"bonus"`
+}
+
+// rewardTier is a named tier reached by receipts with at least MinPoints points
+type rewardTier struct {
+	Name      string `json:"name"`
+	MinPoints int    `json:"minPoints"`
+}
+
+// tierFor returns the name of the highest tier the point total reaches, or "" if it reaches none
+func tierFor(points int, config ScoringConfig) string {
+	tier, best := "", 0
+	for _, t := range config.Tiers {
+		if points >= t.MinPoints && (tier == "" || t.MinPoints >= best) {
+			tier, best = t.Name, t.MinPoints
+		}
+	}
+	return tier
+}
+
+// scoringRule is a single named step in the points pipeline
+type scoringRule struct {
+	Name  string
+	Apply func(r *receipt, config ScoringConfig, history receiptHistory) (int, error)
+}
+
+// pointsAdjustment is a named step applied after the rules are summed; it returns the adjusted total
+type pointsAdjustment struct {
+	Name  string
+	Apply func(r *receipt, config ScoringConfig, history receiptHistory, total int) (int, error)
+}
+
+// receiptHistory gives cross-receipt rules read access to other stored receipts.
+// Scoring is passed a nil history when no store is available, and store-aware rules then award nothing.
+type receiptHistory interface {
+	// retailerReceipts returns every stored receipt from the retailer (case-insensitive) in insertion order
+	retailerReceipts(retailer string) []receipt
+	// dateRangeReceipts returns every stored receipt purchased within the inclusive ISO date range
+	dateRangeReceipts(start string, end string) []receipt
+}
+
+// errors returned by the scoring rules when a receipt field can't be parsed
+var (
+	errInvalidTotal = errors.New("invalid total")
+	errInvalidPrice = errors.New("invalid item price(s)")
+	errInvalidDate  = errors.New("invalid date of purchase")
+	errInvalidTime  = errors.New("invalid time of purchase")
+)
+
+// scoringRules is the ordered list of rules summed by calculatePoints
+var scoringRules = []scoringRule{
+	{Name: "retailerName", Apply: retailerNameRule},
+	{Name: "evenRetailerName", Apply: evenRetailerNameRule},
+	{Name: "roundDollar", Apply: roundDollarRule},
+	{Name: "quarterMultiple", Apply: quarterMultipleRule},
+	{Name: "itemPairs", Apply: itemPairsRule},
+	{Name: "itemDescription", Apply: itemDescriptionRule},
+	{Name: "oddDay", Apply: oddDayRule},
+	{Name: "afternoon", Apply: afternoonRule},
+	{Name: "topOfHour", Apply: topOfHourRule},
+	{Name: "itemCategory", Apply: itemCategoryRule},
+	{Name: "itemKeyword", Apply: itemKeywordRule},
+	{Name: "uniqueDescriptions", Apply: uniqueDescriptionsRule},
+	{Name: "largePurchase", Apply: largePurchaseRule},
+	{Name: "centsModulus", Apply: centsModulusRule},
+	{Name: "logTotal", Apply: logTotalRule},
+	{Name: "pointsPerDollar", Apply: pointsPerDollarRule},
+	{Name: "totalDigits", Apply: totalDigitsRule},
+	{Name: "composite", Apply: compositeRulesRule},
+	{Name: "weekend", Apply: weekendRule},
+	{Name: "promoWindow", Apply: promoWindowRule},
+	{Name: "oddItemCount", Apply: oddItemCountRule},
+	{Name: "firstOfMonth", Apply: firstOfMonthRule},
+	{Name: "premiumPurchase", Apply: premiumPurchaseRule},
+	{Name: "purchaseStreak", Apply: purchaseStreakRule},
+}
+
+// ruleContribution is the number of points a single rule contributed to a receipt's total
+type ruleContribution struct {
+	Rule   string `json:"rule"`
+	Points int    `json:"points"`
+}
+
+// pointsAdjustments is the ordered list of adjustments applied to the summed rule points
+var pointsAdjustments = []pointsAdjustment{
+	{Name: "retailerParticipation", Apply: retailerParticipationAdjustment},
+	{Name: "minimumTotal", Apply: minimumTotalAdjustment},
+	{Name: "sameDayRepeat", Apply: sameDayRepeatAdjustment},
+	{Name: "ageDecay", Apply: ageDecayAdjustment},
+	{Name: "missingTimePenalty", Apply: missingTimePenaltyAdjustment},
+	{Name: "roundTotalPenalty", Apply: roundTotalPenaltyAdjustment},
+	{Name: "retailerMultiplier", Apply: retailerMultiplierAdjustment},
+	{Name: "finalRounding", Apply: finalRoundingAdjustment},
+	{Name: maxPointsAdjustmentName, Apply: maxPointsAdjustment},
+}
+
+// maxPointsAdjustmentName is the breakdown entry recorded when a receipt's total hit the MaxPoints cap
+const maxPointsAdjustmentName = "maxPointsCap"
+
+// calculateBreakdown runs a receipt through every enabled scoring rule and adjustment and returns each one's
+// contribution. Adjustments are recorded as the change they made to the running total, so the
+// contributions always sum to the final point total.
+func calculateBreakdown(r *receipt, config ScoringConfig, history receiptHistory) ([]ruleContribution, error) {
+	breakdown := []ruleContribution{}
+	pointTotal := 0 // running tally for receipt points
+
+	for _, rule := range scoringRules {
+		if config.DisabledRules[rule.Name] {
+			continue
+		}
+
+		points, err := rule.Apply(r, config, history)
+		if err != nil {
+			return nil, err
+		}
+		breakdown = append(breakdown, ruleContribution{Rule: rule.Name, Points: points})
+		pointTotal += points
+	}
+
+	for _, adjustment := range pointsAdjustments {
+		if config.DisabledRules[adjustment.Name] {
+			continue
+		}
+
+		adjusted, err := adjustment.Apply(r, config, history, pointTotal)
+		if err != nil {
+			return nil, err
+		}
+		if adjusted != pointTotal {
+			breakdown = append(breakdown, ruleContribution{Rule: adjustment.Name, Points: adjusted - pointTotal})
+			pointTotal = adjusted
+		}
+	}
+
+	return breakdown, nil
+}
+
+// calculatePoints runs a receipt through every scoring rule and returns the point total.
+// history may be nil, in which case rules that consult other stored receipts award nothing.
+func calculatePoints(r *receipt, config ScoringConfig, history receiptHistory) (int, error) {
+	breakdown, err := calculateBreakdown(r, config, history)
+	if err != nil {
+		return 0, err
+	}
+
+	pointTotal := 0
+	for _, contribution := range breakdown {
+		pointTotal += contribution.Points
+	}
+
+	return pointTotal, nil
+}
+
+// errAmountTooLarge is returned by parseCents for amounts too large to count in int64 cents
+var errAmountTooLarge = errors.New("amount is too large")
+
+// parseCents converts a decimal dollar amount such as "35.50" into an integer number of cents.
+// Amounts with more than two decimal places can't be represented and are rejected.
+func parseCents(amount string) (int64, error) {
+	dollars, cents, hasCents := strings.Cut(amount, ".")
+	if dollars == "" || len(cents) > 2 || (hasCents && cents == "") {
+		return 0, errors.New("invalid amount")
+	}
+
+	dollarsInt, err := strconv.ParseInt(dollars, 10, 64)
+	if errors.Is(err, strconv.ErrRange) || dollarsInt > math.MaxInt64/100 {
+		return 0, errAmountTooLarge
+	}
+	if err != nil || dollarsInt < 0 {
+		return 0, errors.New("invalid amount")
+	}
+
+	centsInt := int64(0)
+	if cents != "" {
+		for len(cents) < 2 {
+			cents += "0"
+		}
+		centsInt, err = strconv.ParseInt(cents, 10, 64)
+		if err != nil || centsInt < 0 {
+			return 0, errors.New("invalid amount")
+		}
+	}
+
+	return dollarsInt*100 + centsInt, nil
+}
+
+// formatCents converts an integer number of cents back into a two-decimal dollar amount such as "35.50"
+func formatCents(cents int64) string {
+	return fmt.Sprintf("%d.%02d", cents/100, cents%100)
+}
+
+// retailerNameRule awards points for every alphanumeric char in retailer name,
+// weighting letters and digits by their configured values (one point each by default)
+func retailerNameRule(r *receipt, config ScoringConfig, history receiptHistory) (int, error) {
+	points := 0
+	for _, char := range r.Retailer {
+		if unicode.IsLetter(char) {
+			points += config.RetailerLetterPoints
+		} else if unicode.IsDigit(char) {
+			points += config.RetailerDigitPoints
+		}
+	}
+
+	if config.RetailerPointsCap > 0 && points > config.RetailerPointsCap {
+		points = config.RetailerPointsCap
+	}
+	return points, nil
+}
+
+// alphanumericCount returns the number of letters and digits in s
+func alphanumericCount(s string) int {
+	count := 0
+	for _, char := range s {
+		if unicode.IsLetter(char) || unicode.IsDigit(char) {
+			count++
+		}
+	}
+	return count
+}
+
+// evenRetailerNameRule awards points if the retailer name has an even number of alphanumeric characters
+func evenRetailerNameRule(r *receipt, config ScoringConfig, history receiptHistory) (int, error) {
+	if config.EvenRetailerNamePoints == 0 {
+		return 0, nil
+	}
+
+	if count := alphanumericCount(r.Retailer); count > 0 && count%2 == 0 {
+		return config.EvenRetailerNamePoints, nil
+	}
+	return 0, nil
+}
+
+// roundDollarRule awards points if the receipt total is a round dollar amount with no cents
+func roundDollarRule(r *receipt, config ScoringConfig, history receiptHistory) (int, error) {
+	totalFloat, err := strconv.ParseFloat(r.Total, 64)
+	if err != nil {
+		return 0, errInvalidTotal
+	}
+
+	if math.Mod(totalFloat, 1) == 0 {
+		return config.RoundDollarPoints, nil
+	}
+	return 0, nil
+}
+
+// quarterMultipleRule awards points if the receipt total is a multiple of 0.25
+func quarterMultipleRule(r *receipt, config ScoringConfig, history receiptHistory) (int, error) {
+	totalFloat, err := strconv.ParseFloat(r.Total, 64)
+	if err != nil {
+		return 0, errInvalidTotal
+	}
+
+	// allow totals within the configured epsilon of a multiple (either side) to qualify
+	remainder := math.Mod(totalFloat, .25)
+	if remainder <= config.QuarterEpsilon || .25-remainder <= config.QuarterEpsilon {
+		return config.QuarterMultiplePoints, nil
+	}
+	return 0, nil
+}
+
+// itemPairsRule awards points for every two items on the receipt, or a tiered bonus when ItemCountTiers is configured,
+// or points weighted by the average item price when PairPriceFactor is configured
+func itemPairsRule(r *receipt, config ScoringConfig, history receiptHistory) (int, error) {
+	if len(config.ItemCountTiers) > 0 {
+		return itemCountTierBonus(len(r.Items), config.ItemCountTiers), nil
+	}
+	if config.PairPriceFactor != 0 {
+		return pairPricePoints(r.Items, config.PairPriceFactor)
+	}
+	return (len(r.Items) / 2) * config.ItemPairPoints, nil
+}
+
+// pairPricePoints returns pairs * round(average item price * factor), averaging the prices in integer cents
+func pairPricePoints(items []item, factor float64) (int, error) {
+	pairs := len(items) / 2
+	if pairs == 0 {
+		return 0, nil
+	}
+
+	var totalCents int64
+	for _, item := range items {
+		cents, err := parseCents(item.Price)
+		if err != nil {
+			return 0, errInvalidPrice
+		}
+		totalCents += cents
+	}
+	averageCents := totalCents / int64(len(items))
+	return pairs * int(math.Round(float64(averageCents)/100*factor)), nil
+}
+
+// itemCountTierBonus returns the bonus of the highest tier the item count reaches, or 0 if it reaches none
+func itemCountTierBonus(count int, tiers []itemCountTier) int {
+	bonus, best := 0, -1
+	for _, tier := range tiers {
+		if count >= tier.MinItems && tier.MinItems > best {
+			bonus, best = tier.Bonus, tier.MinItems
+		}
+	}
+	return bonus
+}
+
+// itemDescriptionRule iterates through every item listed on the receipt.
+// If the trimmed length of the item description is a multiple of 3,
+// multiply the price by the configured multiplier (0.2 by default) and round up. Add that many points.
+func itemDescriptionRule(r *receipt, config ScoringConfig, history receiptHistory) (int, error) {
+	points := 0.0
+	for _, item := range r.Items {
+		itemPoints, err := itemDescriptionPoints(item, config)
+		if err != nil {
+			return 0, err
+		}
+		points += itemPoints
+	}
+	if config.ItemPriceRoundAtEnd {
+		points = roundUpToStep(points, config.ItemPriceRoundingStep)
+	}
+	return int(math.Ceil(points)), nil
+}
+
+// itemDescriptionPoints returns the description-length points for a single item,
+// left unrounded when the config rounds only the rule total
+func itemDescriptionPoints(item item, config ScoringConfig) (float64, error) {
+	if len(strings.TrimSpace(item.ShortDescription))%3 != 0 {
+		return 0, nil
+	}
+
+	// parse price of item
+	priceFloat, err := strconv.ParseFloat(item.Price, 64)
+	if err != nil {
+		return 0, errInvalidPrice
+	}
+
+	itemPoints := priceFloat * config.ItemPriceMultiplier
+	if !config.ItemPriceRoundAtEnd {
+		itemPoints = roundUpToStep(itemPoints, config.ItemPriceRoundingStep)
+	}
+	return itemPoints, nil
+}
+
+// roundUpToStep rounds points up to the next multiple of step, treating a step of 0 or less as 1
+func roundUpToStep(points float64, step float64) float64 {
+	if step <= 0 {
+		step = 1
+	}
+	return math.Ceil(points/step) * step
+}
+
+// oddDayRule awards points if the day in the purchase date is odd
+func oddDayRule(r *receipt, config ScoringConfig, history receiptHistory) (int, error) {
+	purchaseDate, err := programDate(r)
+	if err != nil {
+		return 0, err
+	}
+
+	if purchaseDate.Day()%2 == 1 {
+		return config.OddDayPoints, nil
+	}
+	return 0, nil
+}
+
+// afternoonRule awards points if the time of purchase is after 2:00pm (inclusive) and before 4:00pm (exclusive)
+func afternoonRule(r *receipt, config ScoringConfig, history receiptHistory) (int, error) {
+	if missingTime(r) {
+		return 0, nil
+	}
+
+	purchaseTime, err := programTime(r)
+	if err != nil {
+		return 0, err
+	}
+
+	if hour := purchaseTime.Hour(); hour == 14 || hour == 15 {
+		return config.AfternoonPoints, nil
+	}
+	return 0, nil
+}
+
+// topOfHourRule awards points if the purchase was made exactly on the hour
+func topOfHourRule(r *receipt, config ScoringConfig, history receiptHistory) (int, error) {
+	if config.TopOfHourPoints == 0 || missingTime(r) {
+		return 0, nil
+	}
+
+	purchaseTime, err := programTime(r)
+	if err != nil {
+		return 0, err
+	}
+
+	if purchaseTime.Minute() == 0 {
+		return config.TopOfHourPoints, nil
+	}
+	return 0, nil
+}
+
+// itemCategoryRule awards the configured category bonus for every item in a bonus category
+func itemCategoryRule(r *receipt, config ScoringConfig, history receiptHistory) (int, error) {
+	points := 0
+	for _, item := range r.Items {
+		if item.Category == "" {
+			continue
+		}
+		points += config.CategoryBonuses[item.Category]
+	}
+	return points, nil
+}
+
+// itemKeywordRule awards the configured keyword bonus for every item whose description contains the keyword
+func itemKeywordRule(r *receipt, config ScoringConfig, history receiptHistory) (int, error) {
+	points := 0
+	for _, item := range r.Items {
+		description := strings.ToLower(item.ShortDescription)
+		for keyword, bonus := range config.KeywordBonuses {
+			if keyword != "" && strings.Contains(description, strings.ToLower(keyword)) {
+				points += bonus
+			}
+		}
+	}
+	return points, nil
+}
+
+// uniqueDescriptionsRule awards points for every distinct item description on the receipt
+func uniqueDescriptionsRule(r *receipt, config ScoringConfig, history receiptHistory) (int, error) {
+	if config.UniqueDescriptionPoints == 0 {
+		return 0, nil
+	}
+
+	distinct := map[string]bool{}
+	for _, item := range r.Items {
+		distinct[strings.ToLower(strings.TrimSpace(item.ShortDescription))] = true
+	}
+	return len(distinct) * config.UniqueDescriptionPoints, nil
+}
+
+// centsModulusRule awards points if the cents part of the total is a multiple of the configured modulus
+func centsModulusRule(r *receipt, config ScoringConfig, history receiptHistory) (int, error) {
+	if config.CentsModulusPoints == 0 || config.CentsModulus <= 0 {
+		return 0, nil
+	}
+
+	totalCents, err := parseCents(r.Total)
+	if err != nil {
+		return 0, errInvalidTotal
+	}
+	if (totalCents%100)%config.CentsModulus == 0 {
+		return config.CentsModulusPoints, nil
+	}
+	return 0, nil
+}
+
+// logTotalRule awards floor(k * ln(total)) points for the configured coefficient k. Totals of a dollar or less
+// would earn nothing or a negative amount, so they're awarded nothing.
+func logTotalRule(r *receipt, config ScoringConfig, history receiptHistory) (int, error) {
+	if config.LogTotalCoefficient == 0 {
+		return 0, nil
+	}
+
+	totalCents, err := parseCents(r.Total)
+	if err != nil {
+		return 0, errInvalidTotal
+	}
+	if totalCents <= 100 {
+		return 0, nil
+	}
+	return int(math.Floor(config.LogTotalCoefficient * math.Log(float64(totalCents)/100))), nil
+}
+
+// pointsPerDollarRule awards the configured points for every whole dollar of the total
+func pointsPerDollarRule(r *receipt, config ScoringConfig, history receiptHistory) (int, error) {
+	if config.PointsPerDollar == 0 {
+		return 0, nil
+	}
+
+	totalCents, err := parseCents(r.Total)
+	if err != nil {
+		return 0, errInvalidTotal
+	}
+	return int(totalCents/100) * config.PointsPerDollar, nil
+}
+
+// totalDigitsRule awards points for every digit in the total, normalized to two decimals so "35" and "35.00"
+// earn the same
+func totalDigitsRule(r *receipt, config ScoringConfig, history receiptHistory) (int, error) {
+	if config.TotalDigitPoints == 0 {
+		return 0, nil
+	}
+
+	totalCents, err := parseCents(r.Total)
+	if err != nil {
+		return 0, errInvalidTotal
+	}
+
+	digits := 0
+	for _, char := range formatCents(totalCents) {
+		if unicode.IsDigit(char) {
+			digits++
+		}
+	}
+	return digits * config.TotalDigitPoints, nil
+}
+
+// largePurchaseRule awards a bonus if the receipt total meets the configured threshold
+func largePurchaseRule(r *receipt, config ScoringConfig, history receiptHistory) (int, error) {
+	if config.LargePurchaseBonus == 0 {
+		return 0, nil
+	}
+
+	totalCents, err := parseCents(r.Total)
+	if err != nil {
+		return 0, errInvalidTotal
+	}
+
+	if totalCents >= config.LargePurchaseThresholdCents {
+		return config.LargePurchaseBonus, nil
+	}
+	return 0, nil
+}
+
+// premiumPurchaseRule awards a bonus when no item on the receipt is priced below the premium threshold
+func premiumPurchaseRule(r *receipt, config ScoringConfig, history receiptHistory) (int, error) {
+	if config.PremiumPurchaseBonus == 0 || len(r.Items) == 0 {
+		return 0, nil
+	}
+
+	for _, item := range r.Items {
+		cents, err := parseCents(item.Price)
+		if err != nil {
+			return 0, errInvalidPrice
+		}
+		if cents < config.PremiumItemPriceCents {
+			return 0, nil
+		}
+	}
+	return config.PremiumPurchaseBonus, nil
+}
+
+// weekendRule awards points if the purchase date falls on a weekend
+func weekendRule(r *receipt, config ScoringConfig, history receiptHistory) (int, error) {
+	if config.WeekendPoints == 0 {
+		return 0, nil
+	}
+
+	purchaseDate, err := programDate(r)
+	if err != nil {
+		return 0, err
+	}
+
+	if weekday := purchaseDate.Weekday(); weekday == time.Saturday || weekday == time.Sunday {
+		return config.WeekendPoints, nil
+	}
+	return 0, nil
+}
+
+// promoWindowRule awards the bonus of every promo window containing the purchase date,
+// summing overlapping windows or taking the largest bonus depending on the config
+func promoWindowRule(r *receipt, config ScoringConfig, history receiptHistory) (int, error) {
+	if len(config.PromoWindows) == 0 {
+		return 0, nil
+	}
+
+	purchaseDate, err := programDate(r)
+	if err != nil {
+		return 0, err
+	}
+	date := purchaseDate.Format(isoDateLayout)
+
+	points := 0
+	for _, window := range config.PromoWindows {
+		// ISO dates compare correctly as strings
+		if date < window.Start || date > window.End {
+			continue
+		}
+		if config.PromoOverlap == "max" {
+			if window.Bonus > points {
+				points = window.Bonus
+			}
+		} else {
+			points += window.Bonus
+		}
+	}
+	return points, nil
+}
+
+// sameDayRepeatAdjustment scales down the total for each earlier receipt from the same retailer on the same day
+func sameDayRepeatAdjustment(r *receipt, config ScoringConfig, history receiptHistory, total int) (int, error) {
+	if config.SameDayRepeatFactor <= 0 || history == nil {
+		return total, nil
+	}
+
+	earlier := 0
+	date := programDateKey(r)
+	for _, other := range history.retailerReceipts(r.Retailer) {
+		// receipts are listed in insertion order, so stop once this receipt is reached
+		if other.ID == r.ID {
+			break
+		}
+		if other.DeletedAt == nil && programDateKey(&other) == date {
+			earlier++
+		}
+	}
+
+	return int(math.Round(float64(total) * math.Pow(config.SameDayRepeatFactor, float64(earlier)))), nil
+}
+
+// ageDecayAdjustment scales down the total for each full decay period since the purchase date, using the
+// server clock in the configured timezone. Purchases dated in the future are not decayed.
+func ageDecayAdjustment(r *receipt, config ScoringConfig, history receiptHistory, total int) (int, error) {
+	if config.AgeDecayFactor <= 0 {
+		return total, nil
+	}
+
+	purchased, err := programDate(r)
+	if err != nil {
+		return 0, err
+	}
+
+	year, month, day := purchased.Date()
+	purchaseDate := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	year, month, day = now().In(appSettings.Timezone).Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	ageDays := int(today.Sub(purchaseDate).Hours() / 24)
+	if ageDays <= 0 {
+		return total, nil
+	}
+
+	periodDays := config.AgeDecayPeriodDays
+	if periodDays <= 0 {
+		periodDays = 1
+	}
+	periods := ageDays / periodDays
+
+	return int(math.Round(float64(total) * math.Pow(config.AgeDecayFactor, float64(periods)))), nil
+}
+
+// retailerMultipliers maps lower-cased retailer names to their multipliers
+type retailerMultipliers map[string]float64
+
+// UnmarshalJSON lower-cases the retailer names as they're read, rejecting names that differ only by case
+// since which of their multipliers applied would otherwise be arbitrary
+func (m *retailerMultipliers) UnmarshalJSON(data []byte) error {
+	var raw map[string]float64
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*m = retailerMultipliers{}
+	for retailer, multiplier := range raw {
+		key := strings.ToLower(retailer)
+		if _, ok := (*m)[key]; ok {
+			return errors.New("retailerMultipliers lists " + strconv.Quote(key) + " more than once")
+		}
+		(*m)[key] = multiplier
+	}
+	return nil
+}
+
+// retailerMultiplierAdjustment multiplies the total by the configured multiplier for the receipt's retailer
+func retailerMultiplierAdjustment(r *receipt, config ScoringConfig, history receiptHistory, total int) (int, error) {
+	if multiplier, ok := config.RetailerMultipliers[strings.ToLower(r.Retailer)]; ok {
+		return int(math.Round(float64(total) * multiplier)), nil
+	}
+	return total, nil
+}
+
+// finalRoundingAdjustment rounds the total to the nearest multiple of the configured step, rounding halves up
+func finalRoundingAdjustment(r *receipt, config ScoringConfig, history receiptHistory, total int) (int, error) {
+	step := config.FinalRoundingStep
+	if step <= 1 {
+		return total, nil
+	}
+	return (total + step/2) / step * step, nil
+}
+
+// maxPointsAdjustment caps the total at the configured maximum
+func maxPointsAdjustment(r *receipt, config ScoringConfig, history receiptHistory, total int) (int, error) {
+	if config.MaxPoints > 0 && total > config.MaxPoints {
+		return config.MaxPoints, nil
+	}
+	return total, nil
+}
+
+// oddItemCountRule awards points if there is an item left over after pairing, i.e. an odd item count
+func oddItemCountRule(r *receipt, config ScoringConfig, history receiptHistory) (int, error) {
+	if len(r.Items)%2 == 1 {
+		return config.OddItemCountPoints, nil
+	}
+	return 0, nil
+}
+
+// firstOfMonthRule awards points if no other receipt from the same retailer was purchased earlier in the
+// same calendar month. Receipts purchased at the same date and time go to whichever was stored first.
+func firstOfMonthRule(r *receipt, config ScoringConfig, history receiptHistory) (int, error) {
+	if config.FirstOfMonthPoints == 0 || history == nil {
+		return 0, nil
+	}
+
+	purchased, err := programMoment(r)
+	if err != nil {
+		return 0, err
+	}
+
+	storedBefore := true // whether other is stored ahead of r; flips once r is reached
+	for _, other := range history.retailerReceipts(r.Retailer) {
+		if other.ID == r.ID {
+			storedBefore = false
+			continue
+		}
+		if other.DeletedAt != nil {
+			continue
+		}
+
+		otherPurchased, err := programMoment(&other)
+		if err != nil || otherPurchased.Year() != purchased.Year() || otherPurchased.Month() != purchased.Month() {
+			continue
+		}
+		if otherPurchased.Before(purchased) || (otherPurchased.Equal(purchased) && storedBefore) {
+			return 0, nil
+		}
+	}
+	return config.FirstOfMonthPoints, nil
+}
+
+// purchaseStreakRule awards points if the retailer has a receipt on every one of the streak's days, counting
+// back from this receipt's purchase date, which this receipt itself covers
+func purchaseStreakRule(r *receipt, config ScoringConfig, history receiptHistory) (int, error) {
+	if config.StreakBonus == 0 || history == nil {
+		return 0, nil
+	}
+
+	purchaseDate, err := programDate(r)
+	if err != nil {
+		return 0, err
+	}
+	days := config.StreakDays
+	if days < 1 {
+		days = 3
+	}
+
+	// the history is indexed by literal purchase date, which can be a day either side of the program date
+	start := purchaseDate.AddDate(0, 0, -days).Format(isoDateLayout)
+	end := purchaseDate.AddDate(0, 0, 1).Format(isoDateLayout)
+	visited := map[string]bool{purchaseDate.Format(isoDateLayout): true}
+	for _, other := range history.dateRangeReceipts(start, end) {
+		if other.DeletedAt == nil && strings.EqualFold(other.Retailer, r.Retailer) {
+			visited[programDateKey(&other)] = true
+		}
+	}
+
+	for day := 1; day < days; day++ {
+		if !visited[purchaseDate.AddDate(0, 0, -day).Format(isoDateLayout)] {
+			return 0, nil
+		}
+	}
+	return config.StreakBonus, nil
+}
+
+// purchaseMoment combines a receipt's purchase date and time into a single time for ordering receipts
+func purchaseMoment(r *receipt) (time.Time, error) {
+	purchaseDate, err := parsePurchaseDate(r.PurchaseDate, appSettings.DateLayouts)
+	if err != nil {
+		return time.Time{}, errInvalidDate
+	}
+	if missingTime(r) {
+		return purchaseDate, nil
+	}
+	purchaseTime, err := parsePurchaseTime(r.PurchaseTime)
+	if err != nil {
+		return time.Time{}, errInvalidTime
+	}
+	return purchaseDate.Add(time.Duration(purchaseTime.Hour())*time.Hour + time.Duration(purchaseTime.Minute())*time.Minute), nil
+}
+
+// programMoment returns the purchase moment, read in the receipt timezone, as seen in the program timezone.
+// Receipts without a purchase time, or any receipt when no program timezone is set, keep their literal moment.
+func programMoment(r *receipt) (time.Time, error) {
+	moment, err := purchaseMoment(r)
+	if err != nil || missingTime(r) || appSettings.ProgramTimezone == nil {
+		return moment, err
+	}
+
+	local := time.Date(moment.Year(), moment.Month(), moment.Day(), moment.Hour(), moment.Minute(), 0, 0,
+		appSettings.ReceiptTimezone)
+	return local.In(appSettings.ProgramTimezone), nil
+}
+
+// programDate returns the purchase date in the program timezone, or the literal date when none is configured
+func programDate(r *receipt) (time.Time, error) {
+	if appSettings.ProgramTimezone != nil {
+		return programMoment(r)
+	}
+
+	// parse the date with the accepted layouts so the day is found regardless of format
+	purchaseDate, err := parsePurchaseDate(r.PurchaseDate, appSettings.DateLayouts)
+	if err != nil {
+		return time.Time{}, errInvalidDate
+	}
+	return purchaseDate, nil
+}
+
+// programDateKey returns the purchase date in the program timezone as ISO YYYY-MM-DD, falling back to the
+// receipt's normalized literal date if it can't be parsed
+func programDateKey(r *receipt) string {
+	purchaseDate, err := programDate(r)
+	if err != nil {
+		return dateKey(r.PurchaseDate)
+	}
+	return purchaseDate.Format(isoDateLayout)
+}
+
+// programTime returns the purchase time in the program timezone, or the literal time when none is configured
+func programTime(r *receipt) (time.Time, error) {
+	if appSettings.ProgramTimezone != nil {
+		return programMoment(r)
+	}
+
+	purchaseTime, err := parsePurchaseTime(r.PurchaseTime)
+	if err != nil {
+		return time.Time{}, errInvalidTime
+	}
+	return purchaseTime, nil
+}
+
+// missingTime reports whether a receipt was accepted without a purchase time, which lenient mode allows
+func missingTime(r *receipt) bool {
+	return appSettings.LenientParsing && strings.TrimSpace(r.PurchaseTime) == ""
+}
+
+// missingTimePenaltyAdjustment docks the configured penalty from receipts without a purchase time, floored at zero
+func missingTimePenaltyAdjustment(r *receipt, config ScoringConfig, history receiptHistory, total int) (int, error) {
+	if config.MissingTimePenalty == 0 || !missingTime(r) {
+		return total, nil
+	}
+	if total -= config.MissingTimePenalty; total < 0 {
+		total = 0
+	}
+	return total, nil
+}
+
+// roundTotalPenaltyAdjustment docks the configured penalty from receipts with suspiciously round totals,
+// floored at zero
+func roundTotalPenaltyAdjustment(r *receipt, config ScoringConfig, history receiptHistory, total int) (int, error) {
+	if config.RoundTotalPenalty == 0 {
+		return total, nil
+	}
+
+	modulus := config.RoundTotalModulusCents
+	if modulus <= 0 {
+		modulus = 10000
+	}
+	totalCents, err := parseCents(r.Total)
+	if err != nil {
+		return 0, errInvalidTotal
+	}
+	if totalCents == 0 || totalCents%modulus != 0 {
+		return total, nil
+	}
+
+	if total -= config.RoundTotalPenalty; total < 0 {
+		total = 0
+	}
+	return total, nil
+}
+
+// participates reports whether a retailer is eligible for points under the allow/deny lists
+func participates(retailer string, config ScoringConfig) bool {
+	for _, denied := range config.DeniedRetailers {
+		if strings.EqualFold(denied, retailer) {
+			return false
+		}
+	}
+	if len(config.AllowedRetailers) == 0 {
+		return true
+	}
+	for _, allowed := range config.AllowedRetailers {
+		if strings.EqualFold(allowed, retailer) {
+			return true
+		}
+	}
+	return false
+}
+
+// retailerParticipationAdjustment zeroes the total for receipts from non-participating retailers
+func retailerParticipationAdjustment(r *receipt, config ScoringConfig, history receiptHistory, total int) (int, error) {
+	if participates(r.Retailer, config) {
+		return total, nil
+	}
+	return 0, nil
+}
+
+// minimumTotalAdjustment zeroes the total for receipts whose purchase total is below the configured minimum
+func minimumTotalAdjustment(r *receipt, config ScoringConfig, history receiptHistory, total int) (int, error) {
+	if config.MinimumTotalCents <= 0 {
+		return total, nil
+	}
+
+	totalCents, err := parseCents(r.Total)
+	if err != nil {
+		return 0, errInvalidTotal
+	}
+	if totalCents < config.MinimumTotalCents {
+		return 0, nil
+	}
+	return total, nil
+}
@@ -0,0 +1,965 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestItemCategoryRule(t *testing.T) {
+	config := defaultScoringConfig()
+	config.CategoryBonuses = map[string]int{"produce": 5}
+
+	tests := []struct {
+		name   string
+		items  []item
+		points int
+	}{
+		{"bonus category", []item{{ShortDescription: "Apple", Price: "1.00", Category: "produce"}}, 5},
+		{"one bonus per qualifying item", []item{
+			{ShortDescription: "Apple", Price: "1.00", Category: "produce"},
+			{ShortDescription: "Pear", Price: "1.00", Category: "produce"},
+		}, 10},
+		{"category without a bonus", []item{{ShortDescription: "Soap", Price: "1.00", Category: "household"}}, 0},
+		{"no category", []item{{ShortDescription: "Apple", Price: "1.00"}}, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			points, err := itemCategoryRule(&receipt{Items: test.items}, config, nil)
+			if err != nil || points != test.points {
+				t.Errorf("itemCategoryRule = %d, %v, want %d", points, err, test.points)
+			}
+		})
+	}
+}
+
+func TestItemCategoryRuleDefaultConfig(t *testing.T) {
+	r := &receipt{Items: []item{{ShortDescription: "Apple", Price: "1.00", Category: "produce"}}}
+	if points, _ := itemCategoryRule(r, defaultScoringConfig(), nil); points != 0 {
+		t.Errorf("default config awarded %d category points, want 0", points)
+	}
+}
+
+func TestLargePurchaseRule(t *testing.T) {
+	config := defaultScoringConfig()
+	config.LargePurchaseThresholdCents = 10000
+	config.LargePurchaseBonus = 20
+
+	tests := []struct {
+		total  string
+		points int
+	}{
+		{"99.99", 0},
+		{"100.00", 20},
+		{"100.01", 20},
+	}
+	for _, test := range tests {
+		t.Run(test.total, func(t *testing.T) {
+			points, err := largePurchaseRule(&receipt{Total: test.total}, config, nil)
+			if err != nil || points != test.points {
+				t.Errorf("largePurchaseRule = %d, %v, want %d", points, err, test.points)
+			}
+		})
+	}
+}
+
+func TestLargePurchaseRuleDisabledByDefault(t *testing.T) {
+	if points, _ := largePurchaseRule(&receipt{Total: "100000.00"}, defaultScoringConfig(), nil); points != 0 {
+		t.Errorf("default config awarded %d large purchase points, want 0", points)
+	}
+}
+
+// specReceipt decodes one of the spec example receipts for rule tests
+func specReceipt(t *testing.T, body string) *receipt {
+	t.Helper()
+	var r receipt
+	if err := json.Unmarshal([]byte(body), &r); err != nil {
+		t.Fatal(err)
+	}
+	return &r
+}
+
+func TestDisabledRules(t *testing.T) {
+	tests := []struct {
+		rule   string
+		points int
+	}{
+		{"", 109},
+		{"roundDollar", 59},
+		{"quarterMultiple", 84},
+	}
+	for _, test := range tests {
+		t.Run(test.rule, func(t *testing.T) {
+			config := defaultScoringConfig()
+			if test.rule != "" {
+				config.DisabledRules = map[string]bool{test.rule: true}
+			}
+			points, err := calculatePoints(specReceipt(t, cornerMarketReceipt), config, nil)
+			if err != nil || points != test.points {
+				t.Errorf("calculatePoints = %d, %v, want %d", points, err, test.points)
+			}
+		})
+	}
+}
+
+func TestItemDescriptionRounding(t *testing.T) {
+	// each item earns 0.25 unrounded points at the default 0.2 multiplier
+	items := []item{
+		{ShortDescription: "Dew", Price: "1.25"},
+		{ShortDescription: "Dew", Price: "1.25"},
+		{ShortDescription: "Dew", Price: "1.25"},
+	}
+
+	tests := []struct {
+		name       string
+		step       float64
+		roundAtEnd bool
+		points     int
+	}{
+		{"per item", 1, false, 3},
+		{"at end", 1, true, 1},
+		{"per item half step", 0.5, false, 2},
+		{"at end half step", 0.5, true, 1},
+		{"at end step of 5", 5, true, 5},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := defaultScoringConfig()
+			config.ItemPriceRoundingStep = test.step
+			config.ItemPriceRoundAtEnd = test.roundAtEnd
+			points, err := itemDescriptionRule(&receipt{Items: items}, config, nil)
+			if err != nil || points != test.points {
+				t.Errorf("itemDescriptionRule = %d, %v, want %d", points, err, test.points)
+			}
+		})
+	}
+}
+
+func TestRetailerNameRuleWeights(t *testing.T) {
+	tests := []struct {
+		name         string
+		retailer     string
+		digitPoints  int
+		letterPoints int
+		points       int
+	}{
+		{"default weights", "7-Eleven 24", 1, 1, 9},
+		{"digits weighted 2", "7-Eleven 24", 2, 1, 12},
+		{"letters only", "Target", 2, 1, 6},
+		{"digits only", "711", 2, 1, 6},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := defaultScoringConfig()
+			config.RetailerDigitPoints = test.digitPoints
+			config.RetailerLetterPoints = test.letterPoints
+			points, err := retailerNameRule(&receipt{Retailer: test.retailer}, config, nil)
+			if err != nil || points != test.points {
+				t.Errorf("retailerNameRule(%q) = %d, %v, want %d", test.retailer, points, err, test.points)
+			}
+		})
+	}
+}
+
+func TestRetailerPointsCap(t *testing.T) {
+	tests := []struct {
+		name     string
+		retailer string
+		cap      int
+		points   int
+	}{
+		{"uncapped", "ABCDEFGHIJKL", 0, 12},
+		{"below cap", "ABCDEFGHI", 10, 9},
+		{"at cap", "ABCDEFGHIJ", 10, 10},
+		{"above cap", "ABCDEFGHIJKL", 10, 10},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := defaultScoringConfig()
+			config.RetailerPointsCap = test.cap
+			points, err := retailerNameRule(&receipt{Retailer: test.retailer}, config, nil)
+			if err != nil || points != test.points {
+				t.Errorf("retailerNameRule(%q) = %d, %v, want %d", test.retailer, points, err, test.points)
+			}
+		})
+	}
+}
+
+func TestWeekendRule(t *testing.T) {
+	config := defaultScoringConfig()
+	config.WeekendPoints = 10
+
+	tests := []struct {
+		name   string
+		date   string
+		points int
+	}{
+		{"saturday", "2024-03-09", 10},
+		{"sunday", "2024-03-10", 10},
+		{"wednesday", "2024-03-06", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			points, err := weekendRule(&receipt{PurchaseDate: test.date, PurchaseTime: "12:00"}, config, nil)
+			if err != nil || points != test.points {
+				t.Errorf("weekendRule(%s) = %d, %v, want %d", test.date, points, err, test.points)
+			}
+		})
+	}
+
+	if points, _ := weekendRule(&receipt{PurchaseDate: "2024-03-09"}, defaultScoringConfig(), nil); points != 0 {
+		t.Errorf("default config awarded %d weekend points, want 0", points)
+	}
+}
+
+func TestTierFor(t *testing.T) {
+	config := defaultScoringConfig()
+	tests := []struct {
+		points int
+		tier   string
+	}{
+		{0, "bronze"},
+		{28, "bronze"},
+		{49, "bronze"},
+		{50, "silver"},
+		{99, "silver"},
+		{100, "gold"},
+		{109, "gold"},
+	}
+	for _, test := range tests {
+		if tier := tierFor(test.points, config); tier != test.tier {
+			t.Errorf("tierFor(%d) = %q, want %q", test.points, tier, test.tier)
+		}
+	}
+
+	config.Tiers = []rewardTier{{Name: "member", MinPoints: 10}}
+	if tier := tierFor(9, config); tier != "" {
+		t.Errorf("tierFor below every tier = %q, want none", tier)
+	}
+}
+
+func TestPromoWindowRule(t *testing.T) {
+	windows := []promoWindow{
+		{Start: "2024-03-01", End: "2024-03-10", Bonus: 10},
+		{Start: "2024-03-10", End: "2024-03-20", Bonus: 25},
+	}
+
+	tests := []struct {
+		name    string
+		date    string
+		overlap string
+		points  int
+	}{
+		{"inside", "2024-03-05", "", 10},
+		{"on start boundary", "2024-03-01", "", 10},
+		{"on end boundary", "2024-03-20", "", 25},
+		{"outside", "2024-02-29", "", 0},
+		{"overlap sums", "2024-03-10", "", 35},
+		{"overlap takes max", "2024-03-10", "max", 25},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := defaultScoringConfig()
+			config.PromoWindows = windows
+			config.PromoOverlap = test.overlap
+			points, err := promoWindowRule(&receipt{PurchaseDate: test.date, PurchaseTime: "12:00"}, config, nil)
+			if err != nil || points != test.points {
+				t.Errorf("promoWindowRule(%s) = %d, %v, want %d", test.date, points, err, test.points)
+			}
+		})
+	}
+}
+
+func TestSameDayRepeatAdjustment(t *testing.T) {
+	history := newReceiptStore()
+	for _, r := range []receipt{
+		{ID: "first", Retailer: "Target", PurchaseDate: "2024-03-01"},
+		{ID: "other retailer", Retailer: "Costco", PurchaseDate: "2024-03-01"},
+		{ID: "second", Retailer: "Target", PurchaseDate: "2024-03-01"},
+		{ID: "other day", Retailer: "Target", PurchaseDate: "2024-03-02"},
+		{ID: "third", Retailer: "target", PurchaseDate: "2024-03-01"},
+	} {
+		history.add(r)
+	}
+	config := defaultScoringConfig()
+	config.SameDayRepeatFactor = 0.5
+
+	tests := []struct {
+		id     string
+		points int
+	}{
+		{"first", 100},
+		{"other retailer", 100},
+		{"second", 50},
+		{"other day", 100},
+		{"third", 25},
+	}
+	for _, test := range tests {
+		t.Run(test.id, func(t *testing.T) {
+			r, _ := history.get(test.id)
+			points, err := sameDayRepeatAdjustment(&r, config, history, 100)
+			if err != nil || points != test.points {
+				t.Errorf("sameDayRepeatAdjustment = %d, %v, want %d", points, err, test.points)
+			}
+		})
+	}
+
+	r, _ := history.get("third")
+	if points, _ := sameDayRepeatAdjustment(&r, defaultScoringConfig(), history, 100); points != 100 {
+		t.Errorf("default config adjusted the total to %d, want 100", points)
+	}
+}
+
+func TestFinalRoundingAdjustment(t *testing.T) {
+	tests := []struct {
+		name   string
+		step   int
+		total  int
+		points int
+	}{
+		{"none", 0, 87, 87},
+		{"nearest 5", 5, 87, 85},
+		{"nearest 10", 10, 87, 90},
+		{"half rounds up", 10, 85, 90},
+		{"already a multiple", 5, 85, 85},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := defaultScoringConfig()
+			config.FinalRoundingStep = test.step
+			points, err := finalRoundingAdjustment(&receipt{}, config, nil, test.total)
+			if err != nil || points != test.points {
+				t.Errorf("finalRoundingAdjustment(%d) = %d, %v, want %d", test.total, points, err, test.points)
+			}
+		})
+	}
+}
+
+func TestQuarterMultipleEpsilon(t *testing.T) {
+	tests := []struct {
+		name    string
+		total   string
+		epsilon float64
+		points  int
+	}{
+		{"exact quarter", "1.25", 0, 25},
+		{"just above a quarter without tolerance", "1.250000001", 0, 0},
+		{"just above a quarter", "1.250000001", 1e-6, 25},
+		{"just below a quarter", "1.249999999", 1e-6, 25},
+		{"not near a quarter", "1.26", 1e-6, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := defaultScoringConfig()
+			config.QuarterEpsilon = test.epsilon
+			points, err := quarterMultipleRule(&receipt{Total: test.total}, config, nil)
+			if err != nil || points != test.points {
+				t.Errorf("quarterMultipleRule(%s) = %d, %v, want %d", test.total, points, err, test.points)
+			}
+		})
+	}
+}
+
+func TestOddItemCountRule(t *testing.T) {
+	config := defaultScoringConfig()
+	config.OddItemCountPoints = 7
+	tests := []struct {
+		name   string
+		items  int
+		points int
+	}{
+		{"odd", 3, 7},
+		{"even", 4, 0},
+		{"single", 1, 7},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			points, err := oddItemCountRule(&receipt{Items: make([]item, test.items)}, config, nil)
+			if err != nil || points != test.points {
+				t.Errorf("oddItemCountRule(%d items) = %d, %v, want %d", test.items, points, err, test.points)
+			}
+		})
+	}
+
+	if points, _ := oddItemCountRule(&receipt{Items: make([]item, 3)}, defaultScoringConfig(), nil); points != 0 {
+		t.Errorf("default config awarded %d odd item count points, want 0", points)
+	}
+}
+
+func TestFirstOfMonthRule(t *testing.T) {
+	history := newReceiptStore()
+	for _, r := range []receipt{
+		{ID: "later", Retailer: "Target", PurchaseDate: "2024-03-20", PurchaseTime: "10:00"},
+		{ID: "first", Retailer: "Target", PurchaseDate: "2024-03-02", PurchaseTime: "10:00"},
+		{ID: "same moment, stored after", Retailer: "Target", PurchaseDate: "2024-03-02", PurchaseTime: "10:00"},
+		{ID: "next month", Retailer: "Target", PurchaseDate: "2024-04-25", PurchaseTime: "10:00"},
+		{ID: "other retailer", Retailer: "Costco", PurchaseDate: "2024-03-25", PurchaseTime: "10:00"},
+	} {
+		history.add(r)
+	}
+	config := defaultScoringConfig()
+	config.FirstOfMonthPoints = 20
+
+	tests := []struct {
+		id     string
+		points int
+	}{
+		{"first", 20},
+		{"later", 0},
+		{"same moment, stored after", 0},
+		{"next month", 20},
+		{"other retailer", 20},
+	}
+	for _, test := range tests {
+		t.Run(test.id, func(t *testing.T) {
+			r, _ := history.get(test.id)
+			points, err := firstOfMonthRule(&r, config, history)
+			if err != nil || points != test.points {
+				t.Errorf("firstOfMonthRule = %d, %v, want %d", points, err, test.points)
+			}
+		})
+	}
+
+	r, _ := history.get("first")
+	if points, _ := firstOfMonthRule(&r, defaultScoringConfig(), history); points != 0 {
+		t.Errorf("default config awarded %d first-of-month points, want 0", points)
+	}
+}
+
+func TestParticipates(t *testing.T) {
+	tests := []struct {
+		name     string
+		allowed  []string
+		denied   []string
+		retailer string
+		want     bool
+	}{
+		{"everyone by default", nil, nil, "Target", true},
+		{"allowed", []string{"target"}, nil, "Target", true},
+		{"not on the allow list", []string{"Costco"}, nil, "Target", false},
+		{"denied", nil, []string{"TARGET"}, "Target", false},
+		{"denied wins over allowed", []string{"Target"}, []string{"Target"}, "Target", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := defaultScoringConfig()
+			config.AllowedRetailers, config.DeniedRetailers = test.allowed, test.denied
+			if got := participates(test.retailer, config); got != test.want {
+				t.Errorf("participates(%q) = %t, want %t", test.retailer, got, test.want)
+			}
+		})
+	}
+}
+
+func TestAgeDecayAdjustment(t *testing.T) {
+	resetState(t)
+	fixedNow(t, time.Date(2024, 3, 29, 15, 0, 0, 0, time.UTC))
+	config := defaultScoringConfig()
+	config.AgeDecayFactor = 0.5
+	config.AgeDecayPeriodDays = 7
+
+	tests := []struct {
+		name   string
+		date   string
+		points int
+	}{
+		{"today", "2024-03-29", 100},
+		{"within the first period", "2024-03-23", 100},
+		{"one period old", "2024-03-22", 50},
+		{"three periods old", "2024-03-08", 13},
+		{"future", "2024-04-02", 100},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			points, err := ageDecayAdjustment(&receipt{PurchaseDate: test.date, PurchaseTime: "12:00"}, config, nil, 100)
+			if err != nil || points != test.points {
+				t.Errorf("ageDecayAdjustment(%s) = %d, %v, want %d", test.date, points, err, test.points)
+			}
+		})
+	}
+
+	if points, _ := ageDecayAdjustment(&receipt{PurchaseDate: "2020-01-01"}, defaultScoringConfig(), nil, 100); points != 100 {
+		t.Errorf("default config decayed the total to %d, want 100", points)
+	}
+}
+
+func TestMinimumTotal(t *testing.T) {
+	// the Target example totals $35.35 and scores 28 points
+	tests := []struct {
+		name    string
+		minimum int64
+		points  int
+	}{
+		{"no minimum", 0, 28},
+		{"below", 3536, 0},
+		{"at", 3535, 28},
+		{"above", 3534, 28},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := defaultScoringConfig()
+			config.MinimumTotalCents = test.minimum
+			points, err := calculatePoints(specReceipt(t, targetReceipt), config, nil)
+			if err != nil || points != test.points {
+				t.Errorf("calculatePoints = %d, %v, want %d", points, err, test.points)
+			}
+		})
+	}
+}
+
+func TestItemCountTiers(t *testing.T) {
+	// tiers are deliberately listed out of order
+	tiers := []itemCountTier{{MinItems: 10, Bonus: 40}, {MinItems: 2, Bonus: 5}, {MinItems: 5, Bonus: 15}}
+
+	tests := []struct {
+		count  int
+		tiered int
+		flat   int
+	}{
+		{0, 0, 0},
+		{1, 0, 0},
+		{2, 5, 5},
+		{4, 5, 10},
+		{5, 15, 10},
+		{9, 15, 20},
+		{10, 40, 25},
+		{25, 40, 60},
+	}
+	for _, test := range tests {
+		r := &receipt{Items: make([]item, test.count)}
+		config := defaultScoringConfig()
+		if points, err := itemPairsRule(r, config, nil); err != nil || points != test.flat {
+			t.Errorf("flat rule for %d items = %d, %v, want %d", test.count, points, err, test.flat)
+		}
+		config.ItemCountTiers = tiers
+		if points, err := itemPairsRule(r, config, nil); err != nil || points != test.tiered {
+			t.Errorf("tiered rule for %d items = %d, %v, want %d", test.count, points, err, test.tiered)
+		}
+	}
+}
+
+func TestPremiumPurchaseRule(t *testing.T) {
+	tests := []struct {
+		name   string
+		prices []string
+		bonus  int
+		points int
+	}{
+		{"every item premium", []string{"10.00", "25.50"}, 50, 50},
+		{"one item at the threshold", []string{"10.00"}, 50, 50},
+		{"one cheap item", []string{"25.50", "9.99"}, 50, 0},
+		{"no items", nil, 50, 0},
+		{"disabled", []string{"10.00", "25.50"}, 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &receipt{}
+			for _, price := range test.prices {
+				r.Items = append(r.Items, item{ShortDescription: "Item", Price: price})
+			}
+			config := defaultScoringConfig()
+			config.PremiumItemPriceCents = 1000
+			config.PremiumPurchaseBonus = test.bonus
+			points, err := premiumPurchaseRule(r, config, nil)
+			if err != nil || points != test.points {
+				t.Errorf("premiumPurchaseRule = %d, %v, want %d", points, err, test.points)
+			}
+		})
+	}
+}
+
+func TestRetailerMultipliers(t *testing.T) {
+	config := defaultScoringConfig()
+	if err := json.Unmarshal([]byte(`{"retailerMultipliers": {"TARGET": 2}}`), &config); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		points int
+	}{
+		{"partner", targetReceipt, 56},
+		{"partner in another case", withFields(t, targetReceipt, map[string]interface{}{"retailer": "target"}), 56},
+		{"normal", cornerMarketReceipt, 109},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			points, err := calculatePoints(specReceipt(t, test.body), config, nil)
+			if err != nil || points != test.points {
+				t.Errorf("calculatePoints = %d, %v, want %d", points, err, test.points)
+			}
+		})
+	}
+
+	if err := json.Unmarshal([]byte(`{"retailerMultipliers": {"Target": 2, "target": 3}}`), &config); err == nil {
+		t.Error("accepted retailers that differ only by case")
+	}
+}
+
+func TestProgramTimezone(t *testing.T) {
+	// 23:30 on the 1st (odd) in UTC is the morning of the 2nd in Tokyo and mid-afternoon of the 1st in Los Angeles
+	r := &receipt{PurchaseDate: "2022-01-01", PurchaseTime: "23:30"}
+
+	tests := []struct {
+		name      string
+		zone      string
+		date      string
+		oddDay    int
+		afternoon int
+	}{
+		{"literal", "", "2022-01-01", 6, 0},
+		{"Tokyo", "Asia/Tokyo", "2022-01-02", 0, 0},
+		{"Los Angeles", "America/Los_Angeles", "2022-01-01", 6, 10},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetState(t)
+			if test.zone != "" {
+				location, err := time.LoadLocation(test.zone)
+				if err != nil {
+					t.Skip("timezone data unavailable")
+				}
+				appSettings.ProgramTimezone = location
+			}
+			config := defaultScoringConfig()
+			if date := programDateKey(r); date != test.date {
+				t.Errorf("program date = %s, want %s", date, test.date)
+			}
+			if points, err := oddDayRule(r, config, nil); err != nil || points != test.oddDay {
+				t.Errorf("oddDayRule = %d, %v, want %d", points, err, test.oddDay)
+			}
+			if points, err := afternoonRule(r, config, nil); err != nil || points != test.afternoon {
+				t.Errorf("afternoonRule = %d, %v, want %d", points, err, test.afternoon)
+			}
+		})
+	}
+}
+
+func TestRoundTotalPenalty(t *testing.T) {
+	tests := []struct {
+		name    string
+		total   string
+		modulus int64
+		penalty int
+		points  int
+	}{
+		{"round hundred", "100.00", 0, 30, 70},
+		{"round multiple of a hundred", "300.00", 0, 30, 70},
+		{"not a round hundred", "100.01", 0, 30, 100},
+		{"round dollar only", "150.00", 0, 30, 100},
+		{"configured modulus", "150.00", 5000, 30, 70},
+		{"floored at zero", "100.00", 0, 500, 0},
+		{"zero total", "0.00", 0, 30, 100},
+		{"disabled", "100.00", 0, 0, 100},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := defaultScoringConfig()
+			config.RoundTotalPenalty = test.penalty
+			config.RoundTotalModulusCents = test.modulus
+			points, err := roundTotalPenaltyAdjustment(&receipt{Total: test.total}, config, nil, 100)
+			if err != nil || points != test.points {
+				t.Errorf("roundTotalPenaltyAdjustment = %d, %v, want %d", points, err, test.points)
+			}
+		})
+	}
+}
+
+func TestPurchaseStreakRule(t *testing.T) {
+	resetState(t)
+	history := newReceiptStore()
+	for _, r := range []receipt{
+		{ID: "day 1", Retailer: "Target", PurchaseDate: "2024-03-01"},
+		{ID: "day 2", Retailer: "target", PurchaseDate: "2024-03-02"},
+		{ID: "day 3", Retailer: "Target", PurchaseDate: "2024-03-03"},
+		{ID: "other retailer day 4", Retailer: "Costco", PurchaseDate: "2024-03-04"},
+		{ID: "day 5", Retailer: "Target", PurchaseDate: "2024-03-05"},
+		{ID: "day 6", Retailer: "Target", PurchaseDate: "2024-03-06"},
+	} {
+		history.add(r)
+	}
+	config := defaultScoringConfig()
+	config.StreakBonus = 25
+
+	tests := []struct {
+		id     string
+		points int
+	}{
+		{"day 1", 0},
+		{"day 2", 0},
+		{"day 3", 25},
+		{"day 5", 0}, // the other retailer's receipt doesn't fill the gap on day 4
+		{"day 6", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.id, func(t *testing.T) {
+			r, _ := history.get(test.id)
+			points, err := purchaseStreakRule(&r, config, history)
+			if err != nil || points != test.points {
+				t.Errorf("purchaseStreakRule = %d, %v, want %d", points, err, test.points)
+			}
+		})
+	}
+
+	// a 2-day streak is reached on day 6 and, over the gap, not on day 5
+	config.StreakDays = 2
+	for id, want := range map[string]int{"day 5": 0, "day 6": 25} {
+		r, _ := history.get(id)
+		if points, _ := purchaseStreakRule(&r, config, history); points != want {
+			t.Errorf("2-day streak for %s = %d, want %d", id, points, want)
+		}
+	}
+
+	r, _ := history.get("day 3")
+	if points, _ := purchaseStreakRule(&r, defaultScoringConfig(), history); points != 0 {
+		t.Errorf("default config awarded %d streak points, want 0", points)
+	}
+}
+
+func TestItemKeywordRule(t *testing.T) {
+	bonuses := map[string]int{"organic": 5, "Local": 3}
+
+	tests := []struct {
+		name         string
+		descriptions []string
+		bonuses      map[string]int
+		points       int
+	}{
+		{"matching item", []string{"Organic Bananas"}, bonuses, 5},
+		{"non-matching item", []string{"Bananas"}, bonuses, 0},
+		{"case-insensitive keyword", []string{"LOCAL honey"}, bonuses, 3},
+		{"per matching item", []string{"organic milk", "Bread", "organic eggs"}, bonuses, 10},
+		{"several keywords on one item", []string{"Local Organic Kale"}, bonuses, 8},
+		{"disabled", []string{"Organic Bananas"}, nil, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &receipt{}
+			for _, description := range test.descriptions {
+				r.Items = append(r.Items, item{ShortDescription: description, Price: "1.00"})
+			}
+			config := defaultScoringConfig()
+			config.KeywordBonuses = test.bonuses
+			points, err := itemKeywordRule(r, config, nil)
+			if err != nil || points != test.points {
+				t.Errorf("itemKeywordRule = %d, %v, want %d", points, err, test.points)
+			}
+		})
+	}
+}
+
+func TestUniqueDescriptionsRule(t *testing.T) {
+	tests := []struct {
+		name         string
+		descriptions []string
+		points       int
+		want         int
+	}{
+		{"all unique", []string{"Dew", "Pizza", "Chips"}, 2, 6},
+		{"duplicates", []string{"Gatorade", "Gatorade", "Gatorade", "Gatorade"}, 2, 2},
+		{"duplicates differing by case and space", []string{"Dew", " dew ", "DEW", "Pizza"}, 2, 4},
+		{"no items", nil, 2, 0},
+		{"disabled", []string{"Dew", "Pizza"}, 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &receipt{}
+			for _, description := range test.descriptions {
+				r.Items = append(r.Items, item{ShortDescription: description, Price: "1.00"})
+			}
+			config := defaultScoringConfig()
+			config.UniqueDescriptionPoints = test.points
+			points, err := uniqueDescriptionsRule(r, config, nil)
+			if err != nil || points != test.want {
+				t.Errorf("uniqueDescriptionsRule = %d, %v, want %d", points, err, test.want)
+			}
+		})
+	}
+}
+
+func TestCentsModulusRule(t *testing.T) {
+	tests := []struct {
+		total   string
+		modulus int64
+		points  int
+	}{
+		{"35.00", 10, 7},
+		{"35.30", 10, 7},
+		{"35.35", 10, 0},
+		{"35.35", 5, 7},
+		{"35.36", 5, 0},
+		{"35.50", 25, 7},
+		{"100.75", 25, 7},
+		{"35.49", 25, 0},
+		{"35.01", 1, 7},
+		{"35.00", 0, 0},
+	}
+	for _, test := range tests {
+		config := defaultScoringConfig()
+		config.CentsModulus = test.modulus
+		config.CentsModulusPoints = 7
+		points, err := centsModulusRule(&receipt{Total: test.total}, config, nil)
+		if err != nil || points != test.points {
+			t.Errorf("centsModulusRule(%s mod %d) = %d, %v, want %d", test.total, test.modulus, points, err, test.points)
+		}
+	}
+
+	if points, _ := centsModulusRule(&receipt{Total: "35.00"}, defaultScoringConfig(), nil); points != 0 {
+		t.Errorf("default config awarded %d points, want 0", points)
+	}
+}
+
+func TestLogTotalRule(t *testing.T) {
+	tests := []struct {
+		total       string
+		coefficient float64
+		points      int
+	}{
+		{"35.35", 10, 35},  // ln 35.35 = 3.565
+		{"100.00", 10, 46}, // ln 100 = 4.605
+		{"9.00", 10, 21},   // ln 9 = 2.197
+		{"1000.00", 2.5, 17},
+		{"1.00", 10, 0},
+		{"0.50", 10, 0},
+		{"0.00", 10, 0},
+		{"35.35", 0, 0},
+	}
+	for _, test := range tests {
+		config := defaultScoringConfig()
+		config.LogTotalCoefficient = test.coefficient
+		points, err := logTotalRule(&receipt{Total: test.total}, config, nil)
+		if err != nil || points != test.points {
+			t.Errorf("logTotalRule(%s, k=%v) = %d, %v, want %d", test.total, test.coefficient, points, err, test.points)
+		}
+	}
+}
+
+func TestEvenRetailerNameRule(t *testing.T) {
+	tests := []struct {
+		retailer string
+		points   int
+		want     int
+	}{
+		{"Target", 4, 4},            // 6 alphanumerics
+		{"Costco", 4, 4},            // 6
+		{"Walmart", 4, 0},           // 7
+		{"M&M Corner Market", 4, 4}, // 14, ignoring the & and spaces
+		{"  7-Eleven  ", 4, 0},      // 7
+		{"&&", 4, 0},                // no alphanumerics at all
+		{"Target", 0, 0},            // disabled
+	}
+	for _, test := range tests {
+		config := defaultScoringConfig()
+		config.EvenRetailerNamePoints = test.points
+		points, err := evenRetailerNameRule(&receipt{Retailer: test.retailer}, config, nil)
+		if err != nil || points != test.want {
+			t.Errorf("evenRetailerNameRule(%q) = %d, %v, want %d", test.retailer, points, err, test.want)
+		}
+	}
+}
+
+func TestPointsPerDollarRule(t *testing.T) {
+	tests := []struct {
+		total  string
+		rate   int
+		points int
+	}{
+		{"35.99", 1, 35},
+		{"35.00", 1, 35},
+		{"0.99", 1, 0},
+		{"35.99", 3, 105},
+		{"1000.01", 2, 2000},
+		{"35.99", 0, 0},
+	}
+	for _, test := range tests {
+		config := defaultScoringConfig()
+		config.PointsPerDollar = test.rate
+		points, err := pointsPerDollarRule(&receipt{Total: test.total}, config, nil)
+		if err != nil || points != test.points {
+			t.Errorf("pointsPerDollarRule(%s at %d) = %d, %v, want %d", test.total, test.rate, points, err, test.points)
+		}
+	}
+}
+
+func TestTopOfHourRule(t *testing.T) {
+	tests := []struct {
+		time   string
+		points int
+		want   int
+	}{
+		{"14:00", 3, 3},
+		{"14:30", 3, 0},
+		{"00:00", 3, 3},
+		{"23:59", 3, 0},
+		{"14:00", 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.time, func(t *testing.T) {
+			resetState(t)
+			config := defaultScoringConfig()
+			config.TopOfHourPoints = test.points
+			points, err := topOfHourRule(&receipt{PurchaseDate: "2022-01-01", PurchaseTime: test.time}, config, nil)
+			if err != nil || points != test.want {
+				t.Errorf("topOfHourRule = %d, %v, want %d", points, err, test.want)
+			}
+		})
+	}
+}
+
+func TestPairPricePoints(t *testing.T) {
+	tests := []struct {
+		name   string
+		prices []string
+		factor float64
+		points int
+	}{
+		{"cheap items", []string{"1.00", "1.00", "1.00", "1.00"}, 2, 4},
+		{"pricey items", []string{"10.00", "10.00", "10.00", "10.00"}, 2, 40},
+		{"mixed prices", []string{"1.00", "19.00", "5.00", "15.00"}, 2, 40},
+		{"odd item count", []string{"1.00", "2.00", "7.00"}, 0.5, 2}, // 1 pair at round(3.33 * 0.5)
+		{"single item", []string{"10.00"}, 2, 0},
+		{"flat rule when disabled", []string{"10.00", "10.00", "10.00", "10.00"}, 0, 10},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &receipt{}
+			for _, price := range test.prices {
+				r.Items = append(r.Items, item{ShortDescription: "Item", Price: price})
+			}
+			config := defaultScoringConfig()
+			config.PairPriceFactor = test.factor
+			points, err := itemPairsRule(r, config, nil)
+			if err != nil || points != test.points {
+				t.Errorf("itemPairsRule = %d, %v, want %d", points, err, test.points)
+			}
+		})
+	}
+
+	if _, err := pairPricePoints([]item{{Price: "1.00"}, {Price: "abc"}}, 2); err == nil {
+		t.Error("pairPricePoints accepted an invalid price")
+	}
+}
+
+func TestTotalDigitsRule(t *testing.T) {
+	tests := []struct {
+		total  string
+		points int
+		want   int
+	}{
+		{"1299.50", 1, 6},
+		{"35.35", 1, 4},
+		{"35", 1, 4}, // normalized to 35.00
+		{"0.05", 1, 3},
+		{"100000.00", 2, 16},
+		{"1299.50", 0, 0},
+	}
+	for _, test := range tests {
+		config := defaultScoringConfig()
+		config.TotalDigitPoints = test.points
+		points, err := totalDigitsRule(&receipt{Total: test.total}, config, nil)
+		if err != nil || points != test.want {
+			t.Errorf("totalDigitsRule(%s) = %d, %v, want %d", test.total, points, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"time"
+)
+
+// serverAddress is the address the server listens on
+const serverAddress = "localhost:9090"
+
+// routeTimeoutWriteMargin is how long past a route's timeout the write deadline is kept open, so the
+// handler's own timeout response still reaches the client
+const routeTimeoutWriteMargin = 5 * time.Second
+
+// newServer wraps the router in an http.Server configured from the settings. The write timeout is raised
+// to outlast the longest ROUTE_TIMEOUTS override, since it would otherwise cut those routes off first.
+func newServer(handler http.Handler, settings settings) *http.Server {
+	writeTimeout := settings.WriteTimeout
+	if writeTimeout > 0 {
+		for _, timeout := range settings.RouteTimeouts {
+			if timeout > 0 && timeout+routeTimeoutWriteMargin > writeTimeout {
+				writeTimeout = timeout + routeTimeoutWriteMargin
+			}
+		}
+	}
+
+	return &http.Server{
+		Addr:         serverAddress,
+		Handler:      handler,
+		ReadTimeout:  settings.ReadTimeout,
+		WriteTimeout: writeTimeout,
+		IdleTimeout:  settings.IdleTimeout,
+	}
+}
+
+// serve starts the server, using HTTPS (which negotiates HTTP/2) when a TLS cert and key are configured
+// and plain HTTP otherwise. The cert files are checked before listening so a bad path fails at startup.
+func serve(server *http.Server, settings settings) error {
+	if settings.TLSCertFile == "" && settings.TLSKeyFile == "" {
+		return server.ListenAndServe()
+	}
+
+	if settings.TLSCertFile == "" || settings.TLSKeyFile == "" {
+		return errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	for _, path := range []string{settings.TLSCertFile, settings.TLSKeyFile} {
+		if _, err := os.Stat(path); err != nil {
+			return err
+		}
+	}
+
+	return server.ListenAndServeTLS(settings.TLSCertFile, settings.TLSKeyFile)
+}
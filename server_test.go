@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSelfSignedCert writes a self-signed certificate for 127.0.0.1 and its key to dir, returning their paths
+func writeSelfSignedCert(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "receipt-processor test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// freeAddress returns a local address with a port that was free when checked
+func freeAddress(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func TestServeTLS(t *testing.T) {
+	resetState(t)
+	appSettings.TLSCertFile, appSettings.TLSKeyFile = writeSelfSignedCert(t, t.TempDir())
+
+	server := newServer(setupRouter(), appSettings)
+	server.Addr = freeAddress(t)
+	go serve(server, appSettings)
+	defer server.Close()
+
+	pool := x509.NewCertPool()
+	certPEM, err := os.ReadFile(appSettings.TLSCertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.AppendCertsFromPEM(certPEM)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}, ForceAttemptHTTP2: true}}
+
+	// the server starts listening in the background, so retry briefly
+	var response *http.Response
+	for attempt := 0; attempt < 50; attempt++ {
+		if response, err = client.Get("https://" + server.Addr + "/status"); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("HTTPS request failed: %v", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK || response.TLS == nil {
+		t.Errorf("status returned %d over TLS %v, want 200 over TLS", response.StatusCode, response.TLS != nil)
+	}
+	if response.ProtoMajor != 2 {
+		t.Errorf("served over %s, want HTTP/2", response.Proto)
+	}
+}
+
+func TestServeTLSChecksCertFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeSelfSignedCert(t, dir)
+
+	tests := []struct {
+		name     string
+		certFile string
+		keyFile  string
+	}{
+		{"missing key setting", certFile, ""},
+		{"missing cert file", filepath.Join(dir, "missing.pem"), keyFile},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			settings := defaultSettings()
+			settings.TLSCertFile, settings.TLSKeyFile = test.certFile, test.keyFile
+			server := newServer(http.NotFoundHandler(), settings)
+			server.Addr = freeAddress(t)
+			if err := serve(server, settings); err == nil {
+				server.Close()
+				t.Error("serve started with invalid TLS settings")
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// startTime is when the server started, set in main and used to report uptime
+var startTime = now()
+
+// persistenceStatus reports whether receipts are persisted beyond the process and if that is working
+type persistenceStatus struct {
+	Enabled bool `json:"enabled"`
+	Healthy bool `json:"healthy"`
+}
+
+// returnStatus represents the server's uptime, store size across tenants, and persistence state
+type returnStatus struct {
+	StartedAt     time.Time         `json:"startedAt"`
+	UptimeSeconds float64           `json:"uptimeSeconds"`
+	StoreSize     int               `json:"storeSize"` // receipts across every tenant
+	Tenants       int               `json:"tenants"`
+	Persistence   persistenceStatus `json:"persistence"`
+}
+
+// getStatus sends the server's uptime since start, the number of stored receipts and tenants, and the persistence state.
+// Receipts are currently only held in memory, so persistence is always reported as disabled.
+func getStatus(context *gin.Context) {
+	uptime := now().Sub(startTime)
+	if uptime < 0 {
+		uptime = 0
+	}
+
+	tenantCount, receiptCount := tenants.size()
+	respondJSON(context, http.StatusOK, returnStatus{
+		StartedAt:     startTime.UTC(),
+		UptimeSeconds: uptime.Seconds(),
+		StoreSize:     receiptCount,
+		Tenants:       tenantCount,
+		Persistence:   persistenceStatus{Enabled: false, Healthy: true},
+	})
+}
+
+// returnSchemaVersion represents the receipt schema version the server stores and the older versions
+// it still accepts and migrates
+type returnSchemaVersion struct {
+	SchemaVersion     int   `json:"schemaVersion"`
+	SupportedVersions []int `json:"supportedVersions"`
+}
+
+// getVersion sends the current receipt schema version and every version clients may still declare
+func getVersion(context *gin.Context) {
+	supported := make([]int, 0, len(receiptSchemas))
+	for version := range receiptSchemas {
+		supported = append(supported, version)
+	}
+	sort.Ints(supported)
+
+	respondJSON(context, http.StatusOK, returnSchemaVersion{SchemaVersion: currentSchemaVersion, SupportedVersions: supported})
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// testStatus fetches the server status, failing the test unless the request succeeds
+func testStatus(t *testing.T) returnStatus {
+	t.Helper()
+	recorder := doRequest(t, http.MethodGet, "/status", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status returned %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var status returnStatus
+	decodeBody(t, recorder, &status)
+	return status
+}
+
+func TestGetStatus(t *testing.T) {
+	resetState(t)
+	if status := testStatus(t); status.StoreSize != 0 {
+		t.Errorf("empty store size = %d, want 0", status.StoreSize)
+	}
+
+	processTestReceipt(t, targetReceipt)
+	processTestReceipt(t, cornerMarketReceipt)
+	status := testStatus(t)
+	if status.UptimeSeconds < 0 {
+		t.Errorf("uptime = %v, want non-negative", status.UptimeSeconds)
+	}
+	if status.StoreSize != 2 {
+		t.Errorf("store size = %d, want 2", status.StoreSize)
+	}
+	if status.Persistence.Enabled {
+		t.Error("persistence reported as enabled for the in-memory store")
+	}
+}
+
+func TestGetVersion(t *testing.T) {
+	resetState(t)
+	recorder := doRequest(t, http.MethodGet, "/version", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("version returned %d", recorder.Code)
+	}
+	var version returnSchemaVersion
+	decodeBody(t, recorder, &version)
+	if version.SchemaVersion != currentSchemaVersion || !reflect.DeepEqual(version.SupportedVersions, []int{schemaV1, schemaV2}) {
+		t.Errorf("version = %+v, want %d supporting 1 and 2", version, currentSchemaVersion)
+	}
+
+	// every older version listed migrates to the current one
+	for _, supported := range version.SupportedVersions {
+		r := receipt{Retailer: "Target", Total: "1.00"}
+		if supported >= schemaV2 {
+			r.Currency = "EUR"
+		}
+		if err := migrateReceipt(&r, supported); err != nil || r.SchemaVersion != version.SchemaVersion {
+			t.Errorf("migrating a v%d receipt = schema %d, %v, want schema %d", supported, r.SchemaVersion, err, version.SchemaVersion)
+		}
+	}
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errors returned by store updates
+var (
+	errReceiptNotFound = errors.New("no receipt found for that id")
+	errVersionConflict = errors.New("receipt version conflict")
+	errNotDeleted      = errors.New("receipt is not deleted")
+)
+
+// receiptStore is an in-memory, concurrency-safe collection of processed receipts.
+// Receipts are kept in insertion order so listings are stable between calls.
+type receiptStore struct {
+	mu       sync.RWMutex
+	receipts map[string]*receipt
+	order    []string
+
+	// byDate is a secondary index from ISO purchase date to the IDs of receipts on that date,
+	// and seq records each receipt's insertion position so index lookups come back in order
+	byDate  map[string]map[string]bool
+	seq     map[string]uint64
+	nextSeq uint64
+}
+
+// newReceiptStore creates an empty receipt store
+func newReceiptStore() *receiptStore {
+	return &receiptStore{
+		receipts: make(map[string]*receipt),
+		byDate:   make(map[string]map[string]bool),
+		seq:      make(map[string]uint64),
+	}
+}
+
+// add stores a receipt under its ID as version 1, returning false without storing anything if a
+// receipt with that ID is already stored
+func (s *receiptStore) add(r receipt) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addLocked(r)
+}
+
+// addOrMerge stores a receipt like add, unless a receipt with the same retailer (case-insensitive), purchase
+// date and total was processed within the window or one with the same ID is already stored, in which case
+// nothing is stored and that receipt's ID is returned with merged set. Both happen under one lock so
+// concurrent double submissions can't both be stored.
+func (s *receiptStore) addOrMerge(r receipt, window time.Duration) (id string, merged bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := now().Add(-window)
+	date, total := dateKey(r.PurchaseDate), normalizedTotal(r.Total)
+	for i := len(s.order) - 1; i >= 0; i-- {
+		existing := s.receipts[s.order[i]]
+		if existing.ProcessedAt.Before(cutoff) {
+			break // insertion order is processing order, so every earlier receipt is older still
+		}
+		if existing.DeletedAt == nil && strings.EqualFold(existing.Retailer, r.Retailer) &&
+			dateKey(existing.PurchaseDate) == date && normalizedTotal(existing.Total) == total {
+			return existing.ID, true
+		}
+	}
+
+	return r.ID, !s.addLocked(r)
+}
+
+// normalizedTotal formats a total with two decimals so e.g. "35" and "35.00" compare equal,
+// returning it unchanged if it can't be parsed
+func normalizedTotal(total string) string {
+	cents, err := parseCents(total)
+	if err != nil {
+		return total
+	}
+	return formatCents(cents)
+}
+
+// addLocked stores a receipt as version 1 and reports whether it was stored; callers must hold the write lock
+func (s *receiptStore) addLocked(r receipt) bool {
+	r.Version = 1
+
+	// content-addressed IDs repeat for identical receipts; keep the one already stored, unless it was
+	// soft-deleted, in which case the resubmission takes its place as a newly processed receipt
+	if existing, exists := s.receipts[r.ID]; exists {
+		if existing.DeletedAt == nil {
+			return false
+		}
+		s.removeLocked(r.ID)
+		r.Version = existing.Version + 1 // keep versions increasing so stale If-Match headers still fail
+	}
+
+	r.ProcessedAt = now()
+	r.UpdatedAt = r.ProcessedAt
+	s.receipts[r.ID] = &r
+	s.order = append(s.order, r.ID)
+	s.seq[r.ID] = s.nextSeq
+	s.nextSeq++
+	s.indexDate(r.ID, r.PurchaseDate)
+	return true
+}
+
+// removeLocked drops a stored receipt and its index entries; callers must hold the write lock
+func (s *receiptStore) removeLocked(id string) {
+	s.unindexDate(id, s.receipts[id].PurchaseDate)
+	delete(s.receipts, id)
+	delete(s.seq, id)
+	for i, orderedID := range s.order {
+		if orderedID == id {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// indexDate adds a receipt ID to the purchase date index; callers must hold the write lock
+func (s *receiptStore) indexDate(id string, purchaseDate string) {
+	key := dateKey(purchaseDate)
+	if s.byDate[key] == nil {
+		s.byDate[key] = make(map[string]bool)
+	}
+	s.byDate[key][id] = true
+}
+
+// unindexDate removes a receipt ID from the purchase date index; callers must hold the write lock
+func (s *receiptStore) unindexDate(id string, purchaseDate string) {
+	key := dateKey(purchaseDate)
+	delete(s.byDate[key], id)
+	if len(s.byDate[key]) == 0 {
+		delete(s.byDate, key)
+	}
+}
+
+// idsByDateRange uses the purchase date index to return, in insertion order, the IDs of receipts
+// purchased between start and end (inclusive ISO dates, either of which may be empty for an open range)
+func (s *receiptStore) idsByDateRange(start string, end string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := []string{}
+	for date, dateIDs := range s.byDate {
+		// ISO dates compare correctly as strings
+		if (start != "" && date < start) || (end != "" && date > end) {
+			continue
+		}
+		for id := range dateIDs {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return s.seq[ids[i]] < s.seq[ids[j]]
+	})
+	return ids
+}
+
+// listByIDs returns copies of the stored receipts with the given IDs, skipping any that no longer exist
+func (s *receiptStore) listByIDs(ids []string) []receipt {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]receipt, 0, len(ids))
+	for _, id := range ids {
+		if r, ok := s.receipts[id]; ok {
+			list = append(list, *r)
+		}
+	}
+	return list
+}
+
+// len returns the number of stored receipts
+func (s *receiptStore) len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.receipts)
+}
+
+// get returns a copy of the receipt with the given ID
+func (s *receiptStore) get(id string) (receipt, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	r, ok := s.receipts[id]
+	if !ok {
+		return receipt{}, false
+	}
+	return *r, true
+}
+
+// latest returns a copy of the most recently processed receipt that isn't deleted. Receipts are inserted in
+// processing order, so it's the last one in the insertion order.
+func (s *receiptStore) latest() (receipt, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for i := len(s.order) - 1; i >= 0; i-- {
+		if r := s.receipts[s.order[i]]; r.DeletedAt == nil {
+			return *r, true
+		}
+	}
+	return receipt{}, false
+}
+
+// replace overwrites the contents of a stored receipt, clearing its cached points and bumping its version.
+// If expectedVersion is non-zero and doesn't match the stored version, errVersionConflict is returned
+// along with the current version. On success the new version is returned.
+func (s *receiptStore) replace(id string, r receipt, expectedVersion int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.receipts[id]
+	if !ok || existing.DeletedAt != nil {
+		return 0, errReceiptNotFound
+	}
+	if expectedVersion != 0 && expectedVersion != existing.Version {
+		return existing.Version, errVersionConflict
+	}
+
+	r.ID = id
+	r.Version = existing.Version + 1
+	r.Points = 0
+	r.ProcessedAt = existing.ProcessedAt
+	r.UpdatedAt = now()
+	s.unindexDate(id, existing.PurchaseDate)
+	s.indexDate(id, r.PurchaseDate)
+	*existing = r
+	return r.Version, nil
+}
+
+// deleteMany removes the receipts with the given IDs in a single locked operation,
+// returning the IDs that were deleted and those that weren't found
+func (s *receiptStore) deleteMany(ids []string) (deleted []string, notFound []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted, notFound = []string{}, []string{}
+	for _, id := range ids {
+		r, ok := s.receipts[id]
+		if !ok {
+			notFound = append(notFound, id)
+			continue
+		}
+		s.unindexDate(id, r.PurchaseDate)
+		delete(s.receipts, id)
+		delete(s.seq, id)
+		deleted = append(deleted, id)
+	}
+
+	// drop the deleted IDs from the insertion order
+	if len(deleted) > 0 {
+		order := s.order[:0]
+		for _, id := range s.order {
+			if _, ok := s.receipts[id]; ok {
+				order = append(order, id)
+			}
+		}
+		s.order = order
+	}
+
+	return deleted, notFound
+}
+
+// softDeleteMany marks the receipts with the given IDs deleted at the current time, keeping them in the store.
+// The deletion also counts as an update so ?since= listings report it. Receipts that don't exist or are
+// already deleted are reported as not found.
+func (s *receiptStore) softDeleteMany(ids []string) (deleted []string, notFound []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted, notFound = []string{}, []string{}
+	deletedAt := now()
+	for _, id := range ids {
+		r, ok := s.receipts[id]
+		if !ok || r.DeletedAt != nil {
+			notFound = append(notFound, id)
+			continue
+		}
+		r.DeletedAt = &deletedAt
+		r.UpdatedAt = deletedAt
+		deleted = append(deleted, id)
+	}
+	return deleted, notFound
+}
+
+// restore clears the deletion marker on a soft-deleted receipt and marks it updated
+func (s *receiptStore) restore(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.receipts[id]
+	if !ok {
+		return errReceiptNotFound
+	}
+	if r.DeletedAt == nil {
+		return errNotDeleted
+	}
+	r.DeletedAt = nil
+	r.UpdatedAt = now()
+	return nil
+}
+
+// dateRangeReceipts returns copies of every stored receipt purchased within the inclusive ISO date range,
+// in insertion order
+func (s *receiptStore) dateRangeReceipts(start string, end string) []receipt {
+	return s.listByIDs(s.idsByDateRange(start, end))
+}
+
+// retailerReceipts returns copies of every stored receipt from the retailer (case-insensitive) in insertion order
+func (s *receiptStore) retailerReceipts(retailer string) []receipt {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := []receipt{}
+	for _, id := range s.order {
+		if r := s.receipts[id]; strings.EqualFold(r.Retailer, retailer) {
+			list = append(list, *r)
+		}
+	}
+	return list
+}
+
+// findByExternalID returns a copy of the first receipt submitted with the given external reference
+func (s *receiptStore) findByExternalID(externalID string) (receipt, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if externalID == "" {
+		return receipt{}, false
+	}
+	for _, id := range s.order {
+		if r := s.receipts[id]; r.ExternalID == externalID {
+			return *r, true
+		}
+	}
+	return receipt{}, false
+}
+
+// setPoints caches the computed point total on a stored receipt
+func (s *receiptStore) setPoints(id string, points int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r, ok := s.receipts[id]; ok {
+		r.Points = points
+		r.pending = false
+	}
+}
+
+// clearPending marks a receipt as no longer awaiting background scoring
+func (s *receiptStore) clearPending(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r, ok := s.receipts[id]; ok {
+		r.pending = false
+	}
+}
+
+// list returns a copy of every stored receipt in insertion order
+func (s *receiptStore) list() []receipt {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]receipt, 0, len(s.order))
+	for _, id := range s.order {
+		list = append(list, *s.receipts[id])
+	}
+	return list
+}
+
+// ids returns the IDs of every stored receipt in insertion order
+func (s *receiptStore) ids() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]string(nil), s.order...)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestIdsByDateRange(t *testing.T) {
+	s := newReceiptStore()
+	s.add(receipt{ID: "a", PurchaseDate: "2024-03-01"})
+	s.add(receipt{ID: "b", PurchaseDate: "2024-03-05"})
+	s.add(receipt{ID: "c", PurchaseDate: "2024-03-01"})
+	s.add(receipt{ID: "d", PurchaseDate: "2024-04-01"})
+
+	tests := []struct {
+		name       string
+		start, end string
+		want       []string
+	}{
+		{"single day", "2024-03-01", "2024-03-01", []string{"a", "c"}},
+		{"inclusive range", "2024-03-01", "2024-03-05", []string{"a", "b", "c"}},
+		{"open start", "", "2024-03-04", []string{"a", "c"}},
+		{"open end", "2024-03-02", "", []string{"b", "d"}},
+		{"no matches", "2025-01-01", "", []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := s.idsByDateRange(test.start, test.end); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("idsByDateRange(%q, %q) = %v, want %v", test.start, test.end, got, test.want)
+			}
+		})
+	}
+}
+
+func TestIdsByDateRangeAfterDeleteAndReplace(t *testing.T) {
+	s := newReceiptStore()
+	s.add(receipt{ID: "a", PurchaseDate: "2024-03-01"})
+	s.add(receipt{ID: "b", PurchaseDate: "2024-03-01"})
+	s.add(receipt{ID: "c", PurchaseDate: "2024-03-02"})
+
+	s.deleteMany([]string{"a"})
+	if got := s.idsByDateRange("2024-03-01", "2024-03-01"); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Errorf("after delete, 2024-03-01 lists %v, want [b]", got)
+	}
+
+	if _, err := s.replace("c", receipt{PurchaseDate: "2024-03-01"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.idsByDateRange("2024-03-01", "2024-03-01"); !reflect.DeepEqual(got, []string{"b", "c"}) {
+		t.Errorf("after replace, 2024-03-01 lists %v, want [b c]", got)
+	}
+	if got := s.idsByDateRange("2024-03-02", "2024-03-02"); len(got) != 0 {
+		t.Errorf("after replace, 2024-03-02 lists %v, want none", got)
+	}
+}
+
+func TestIdsByDateRangeConcurrent(t *testing.T) {
+	s := newReceiptStore()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			s.add(receipt{ID: strconv.Itoa(i), PurchaseDate: "2024-03-01"})
+		}(i)
+		go func() {
+			defer wg.Done()
+			s.idsByDateRange("2024-03-01", "2024-03-01")
+		}()
+	}
+	wg.Wait()
+
+	if got := s.idsByDateRange("2024-03-01", "2024-03-01"); len(got) != 50 {
+		t.Errorf("index lists %d receipts, want 50", len(got))
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultTenant is the tenant whose receipts live in the global store; requests without an X-Tenant-Id
+// header use it when ALLOW_DEFAULT_TENANT is set
+const defaultTenant = "default"
+
+// tenantIDPattern limits tenant IDs to short, header- and log-safe names
+var tenantIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// tenantRegistry holds a separate receipt store per tenant so tenants never see each other's receipts
+type tenantRegistry struct {
+	mu     sync.Mutex
+	stores map[string]*receiptStore
+}
+
+// tenants is the registry of every tenant's store; the default tenant shares the global store
+var tenants = &tenantRegistry{stores: map[string]*receiptStore{defaultTenant: store}}
+
+// lookup returns the tenant's store if it has one; reads never create stores, so unknown tenant IDs
+// can't grow the registry
+func (t *tenantRegistry) lookup(tenant string) (*receiptStore, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.stores[tenant]
+	return s, ok
+}
+
+// size returns the number of tenants with a store and the number of receipts stored across all of them
+func (t *tenantRegistry) size() (tenantCount int, receiptCount int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, s := range t.stores {
+		receiptCount += s.len()
+	}
+	return len(t.stores), receiptCount
+}
+
+// storeFor returns the tenant's store, creating an empty one on first use
+func (t *tenantRegistry) storeFor(tenant string) *receiptStore {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.stores[tenant]
+	if !ok {
+		s = newReceiptStore()
+		t.stores[tenant] = s
+	}
+	return s
+}
+
+// gin context keys set by scopeTenant
+const (
+	tenantKey      = "tenant"
+	tenantStoreKey = "tenantStore"
+)
+
+// scopeTenant is a middleware that resolves the caller's tenant from the X-Tenant-Id header and scopes the
+// request to that tenant's store. Requests without the header are rejected with a 400 unless
+// ALLOW_DEFAULT_TENANT is set, in which case they use the default tenant. A tenant without a store yet is
+// scoped to an empty one that's only registered once the request stores a receipt (see tenantWriteStore).
+func scopeTenant(context *gin.Context) {
+	tenant := context.GetHeader("X-Tenant-Id")
+	switch {
+	case tenant == "" && appSettings.AllowDefaultTenant:
+		tenant = defaultTenant
+	case tenant == "":
+		abortWithError(context, http.StatusBadRequest, "The X-Tenant-Id header is required", nil)
+		return
+	case !tenantIDPattern.MatchString(tenant):
+		abortWithError(context, http.StatusBadRequest, "The X-Tenant-Id header must be 1-64 letters, digits, '-' or '_'", nil)
+		return
+	}
+
+	s, ok := tenants.lookup(tenant)
+	if !ok {
+		s = newReceiptStore()
+	}
+	context.Set(tenantKey, tenant)
+	context.Set(tenantStoreKey, s)
+	context.Next()
+}
+
+// tenantWriteStore returns the store the request should add receipts to, registering the tenant's store
+// if this is its first receipt
+func tenantWriteStore(context *gin.Context) *receiptStore {
+	tenant, ok := context.Get(tenantKey)
+	if !ok {
+		return store
+	}
+
+	s := tenants.storeFor(tenant.(string))
+	context.Set(tenantStoreKey, s)
+	return s
+}
+
+// tenantStore returns the store of the tenant the request was scoped to, or the global store for
+// routes that aren't tenant-scoped
+func tenantStore(context *gin.Context) *receiptStore {
+	if s, ok := context.Get(tenantStoreKey); ok {
+		return s.(*receiptStore)
+	}
+	return store
+}
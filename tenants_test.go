@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestTenantIsolation(t *testing.T) {
+	resetState(t)
+	acme := processTestReceipt(t, targetReceipt, "X-Tenant-Id", "acme")
+	globex := processTestReceipt(t, cornerMarketReceipt, "X-Tenant-Id", "globex")
+
+	tests := []struct {
+		tenant string
+		own    string
+		other  string
+	}{
+		{"acme", acme, globex},
+		{"globex", globex, acme},
+	}
+	for _, test := range tests {
+		t.Run(test.tenant, func(t *testing.T) {
+			var listed []receipt
+			decodeBody(t, doRequest(t, http.MethodGet, "/receipts", "", "X-Tenant-Id", test.tenant), &listed)
+			if len(listed) != 1 || listed[0].ID != test.own {
+				t.Errorf("listed %+v, want only %s", listed, test.own)
+			}
+			if recorder := doRequest(t, http.MethodGet, "/receipts/"+test.own+"/points", "", "X-Tenant-Id", test.tenant); recorder.Code != http.StatusOK {
+				t.Errorf("points for its own receipt returned %d, want 200", recorder.Code)
+			}
+			if recorder := doRequest(t, http.MethodGet, "/receipts/"+test.other+"/points", "", "X-Tenant-Id", test.tenant); recorder.Code != http.StatusNotFound {
+				t.Errorf("points for the other tenant's receipt returned %d, want 404", recorder.Code)
+			}
+		})
+	}
+
+	if count := len(store.list()); count != 0 {
+		t.Errorf("default tenant holds %d receipts, want none", count)
+	}
+}
+
+func TestTenantsShareIDsWithoutColliding(t *testing.T) {
+	resetState(t)
+	idGenerator = contentGenerator{}
+	acme := processTestReceipt(t, targetReceipt, "X-Tenant-Id", "acme")
+	globex := processTestReceipt(t, targetReceipt, "X-Tenant-Id", "globex")
+	if acme != globex {
+		t.Fatalf("content IDs differ across tenants: %s and %s", acme, globex)
+	}
+
+	doRequest(t, http.MethodPost, "/receipts/delete", `{"ids": ["`+acme+`"]}`, "X-Tenant-Id", "acme")
+	if recorder := doRequest(t, http.MethodGet, "/receipts/"+globex+"/points", "", "X-Tenant-Id", "globex"); recorder.Code != http.StatusOK {
+		t.Errorf("points for globex's copy after acme deleted its own returned %d, want 200", recorder.Code)
+	}
+}
+
+func TestScopeTenantHeader(t *testing.T) {
+	tests := []struct {
+		name         string
+		allowDefault bool
+		tenant       string
+		status       int
+	}{
+		{"default allowed", true, "", http.StatusOK},
+		{"default not allowed", false, "", http.StatusBadRequest},
+		{"named tenant", false, "acme_1", http.StatusOK},
+		{"invalid tenant", true, "acme corp", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetState(t)
+			appSettings.AllowDefaultTenant = test.allowDefault
+			if recorder := doRequest(t, http.MethodGet, "/receipts", "", "X-Tenant-Id", test.tenant); recorder.Code != test.status {
+				t.Errorf("listing returned %d, want %d", recorder.Code, test.status)
+			}
+		})
+	}
+}
+
+func TestStatusCountsEveryTenant(t *testing.T) {
+	resetState(t)
+	processTestReceipt(t, targetReceipt)
+	processTestReceipt(t, targetReceipt, "X-Tenant-Id", "acme")
+	processTestReceipt(t, cornerMarketReceipt, "X-Tenant-Id", "acme")
+
+	// reads by unknown tenants don't register them
+	for _, path := range []string{"/receipts", "/receipts/count", "/retailers", "/items"} {
+		doRequest(t, http.MethodGet, path, "", "X-Tenant-Id", "reader")
+	}
+
+	if status := testStatus(t); status.Tenants != 2 || status.StoreSize != 3 {
+		t.Errorf("status = %d tenants with %d receipts, want 2 with 3", status.Tenants, status.StoreSize)
+	}
+}
+
+func TestConsumeReceiptsForTenant(t *testing.T) {
+	resetState(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	queue := newMemoryQueue()
+	go consumeReceipts(ctx, queue, "receipts", "points", "acme")
+	queue.Publish("receipts", []byte(targetReceipt))
+
+	var points queuedPoints
+	if err := json.Unmarshal(nextMessage(t, queue, "points"), &points); err != nil {
+		t.Fatal(err)
+	}
+	if recorder := doRequest(t, http.MethodGet, "/receipts/"+points.ID+"/points", "", "X-Tenant-Id", "acme"); recorder.Code != http.StatusOK {
+		t.Errorf("points for the consumed receipt as acme returned %d, want 200", recorder.Code)
+	}
+	if _, ok := store.get(points.ID); ok {
+		t.Error("consumed receipt was stored for the default tenant")
+	}
+}
@@ -0,0 +1,488 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// now returns the current time; it is a variable so the clock can be replaced in tests
+var now = time.Now
+
+// receiptValidator is a named check run by validateReceipt. Enabled reports whether the check
+// applies under the current settings; Check may normalize the receipt as well as reject it.
+type receiptValidator struct {
+	Name    string
+	Enabled func(settings settings) bool
+	Check   func(r *receipt, settings settings) error
+}
+
+// receiptValidators is the ordered registry of checks run by validateReceipt. Validators that rewrite the
+// receipt (stripping control characters, normalizing amounts) come first, so the checks after them see the
+// values that will be stored.
+var receiptValidators = []receiptValidator{
+	{
+		Name:    "controlCharacters",
+		Enabled: func(settings settings) bool { return settings.ControlChars != controlCharsAllow },
+		Check:   checkControlChars,
+	},
+	{
+		Name:    "amountPrefix",
+		Enabled: func(settings settings) bool { return true },
+		Check:   checkAmountPrefixes,
+	},
+	{
+		Name:    "wholeDollarTotal",
+		Enabled: func(settings settings) bool { return settings.WholeDollarTotals != wholeDollarAllow },
+		Check:   checkWholeDollarTotal,
+	},
+	{
+		Name:    "amountFormat",
+		Enabled: func(settings settings) bool { return settings.AmountFormat != amountFormatAny },
+		Check:   func(r *receipt, settings settings) error { return checkAmounts(r, settings.AmountFormat) },
+	},
+	{
+		Name:    "dateFormat",
+		Enabled: func(settings settings) bool { return true },
+		Check:   checkDateFormat,
+	},
+	{
+		Name:    "timeFormat",
+		Enabled: func(settings settings) bool { return true },
+		Check:   checkTimeFormat,
+	},
+	{
+		Name:    "futureDate",
+		Enabled: func(settings settings) bool { return settings.RejectFutureDates },
+		Check:   checkFutureDate,
+	},
+	{
+		Name:    "maxTotal",
+		Enabled: func(settings settings) bool { return settings.MaxTotalCents > 0 },
+		Check:   checkMaxTotal,
+	},
+	{
+		Name:    "minRetailerLength",
+		Enabled: func(settings settings) bool { return settings.MinRetailerLength > 0 },
+		Check:   checkRetailerLength,
+	},
+	{
+		Name:    "maxItemPrice",
+		Enabled: func(settings settings) bool { return settings.MaxItemPriceCents > 0 },
+		Check:   checkMaxItemPrice,
+	},
+	{
+		Name:    "maxNoteLength",
+		Enabled: func(settings settings) bool { return settings.MaxNoteLength > 0 },
+		Check:   checkNoteLength,
+	},
+	{
+		Name:    "retailerParticipation",
+		Enabled: func(settings settings) bool { return scoringConfig.NonParticipatingAction == "reject" },
+		Check:   checkRetailerParticipation,
+	},
+	{
+		Name:    "descriptionPattern",
+		Enabled: func(settings settings) bool { return settings.DescriptionPattern != nil },
+		Check:   checkDescriptionPattern,
+	},
+}
+
+// checkDateFormat rejects purchase dates that don't match one of the accepted layouts, so receipts that could
+// never be scored are turned away when they're processed rather than when their points are requested
+func checkDateFormat(r *receipt, settings settings) error {
+	_, err := parsePurchaseDate(r.PurchaseDate, settings.DateLayouts)
+	return err
+}
+
+// checkTimeFormat rejects purchase times that aren't in HH:MM format; lenient mode also accepts unpadded
+// times and receipts without a time
+func checkTimeFormat(r *receipt, settings settings) error {
+	if settings.LenientParsing && strings.TrimSpace(r.PurchaseTime) == "" {
+		return nil
+	}
+	_, err := parsePurchaseTime(r.PurchaseTime)
+	return err
+}
+
+// checkRetailerParticipation rejects receipts from retailers outside the scoring config's allow/deny lists
+func checkRetailerParticipation(r *receipt, settings settings) error {
+	if !participates(r.Retailer, scoringConfig) {
+		return errors.New("retailer is not participating in this program")
+	}
+	return nil
+}
+
+// checkMaxTotal rejects totals above the configured maximum, including totals too large to be counted in cents,
+// since float-based rules lose precision on them and would award nonsense points. Totals it can't otherwise
+// read are left to checkAmounts, so the amount format decides which ones are valid.
+func checkMaxTotal(r *receipt, settings settings) error {
+	cents, err := parseCents(r.Total)
+	if errors.Is(err, errAmountTooLarge) || (err == nil && cents > int64(settings.MaxTotalCents)) {
+		return errors.New("total exceeds the maximum of " + formatCents(int64(settings.MaxTotalCents)))
+	}
+	return nil
+}
+
+// checkRetailerLength rejects retailer names with fewer characters (runes, ignoring surrounding space) than the minimum
+func checkRetailerLength(r *receipt, settings settings) error {
+	if utf8.RuneCountInString(strings.TrimSpace(r.Retailer)) < settings.MinRetailerLength {
+		if settings.MinRetailerLength == 1 {
+			return errors.New("retailer must not be empty")
+		}
+		return errors.New("retailer must be at least " + strconv.Itoa(settings.MinRetailerLength) + " characters")
+	}
+	return nil
+}
+
+// checkNoteLength rejects notes longer than the configured maximum
+func checkNoteLength(r *receipt, settings settings) error {
+	if utf8.RuneCountInString(r.Note) > settings.MaxNoteLength {
+		return errors.New("note must be at most " + strconv.Itoa(settings.MaxNoteLength) + " characters")
+	}
+	return nil
+}
+
+// checkMaxItemPrice rejects items priced above the configured maximum, which usually means a data-entry error
+func checkMaxItemPrice(r *receipt, settings settings) error {
+	for _, item := range r.Items {
+		cents, err := parseCents(item.Price)
+		if err != nil {
+			return errors.New("price is not a valid amount")
+		}
+		if cents > int64(settings.MaxItemPriceCents) {
+			return errors.New("price of " + strconv.Quote(item.ShortDescription) + " exceeds the maximum of " +
+				formatCents(int64(settings.MaxItemPriceCents)))
+		}
+	}
+	return nil
+}
+
+// prefixedAmountPattern matches an amount with a leading plus sign or a redundant leading zero, such as
+// "+35.00" or "035.00"
+var prefixedAmountPattern = regexp.MustCompile(`^(\+|0\d)`)
+
+// checkAmountPrefixes rejects totals and prices with a leading plus sign or leading zeros, or in lenient mode
+// rewrites them without, e.g. "+35.00" and "035.00" to "35.00"
+func checkAmountPrefixes(r *receipt, settings settings) error {
+	normalize := func(amount string, field string) (string, error) {
+		if !prefixedAmountPattern.MatchString(amount) {
+			return amount, nil
+		}
+		if !settings.LenientParsing {
+			return "", errors.New(field + " must not have a leading + or leading zeros")
+		}
+
+		amount = strings.TrimLeft(strings.TrimPrefix(amount, "+"), "0")
+		if amount == "" || amount[0] == '.' {
+			amount = "0" + amount
+		}
+		return amount, nil
+	}
+
+	total, err := normalize(r.Total, "total")
+	if err != nil {
+		return err
+	}
+	r.Total = total
+
+	for i := range r.Items {
+		price, err := normalize(r.Items[i].Price, "price")
+		if err != nil {
+			return err
+		}
+		r.Items[i].Price = price
+	}
+	return nil
+}
+
+// accepted values for the WHOLE_DOLLAR_TOTALS setting
+const (
+	wholeDollarAllow     = "allow"
+	wholeDollarReject    = "reject"
+	wholeDollarNormalize = "normalize"
+)
+
+// wholeDollarPattern matches a total with no decimal point, such as "35"
+var wholeDollarPattern = regexp.MustCompile(`^\d+$`)
+
+// checkWholeDollarTotal rejects a total without a decimal point (strict), or rewrites it with zero cents,
+// e.g. "35" to "35.00", so it still meets the two-decimal pattern and earns the round-dollar and quarter bonuses
+func checkWholeDollarTotal(r *receipt, settings settings) error {
+	if !wholeDollarPattern.MatchString(r.Total) {
+		return nil
+	}
+	if settings.WholeDollarTotals == wholeDollarReject {
+		return errors.New("total must include cents, e.g. 35.00")
+	}
+	r.Total += ".00"
+	return nil
+}
+
+// checkDescriptionPattern rejects items whose trimmed short description doesn't match DESCRIPTION_PATTERN
+func checkDescriptionPattern(r *receipt, settings settings) error {
+	for _, item := range r.Items {
+		if !settings.DescriptionPattern.MatchString(strings.TrimSpace(item.ShortDescription)) {
+			return errors.New("shortDescription " + strconv.Quote(item.ShortDescription) + " has characters that aren't allowed")
+		}
+	}
+	return nil
+}
+
+// accepted values for the CONTROL_CHARS setting
+const (
+	controlCharsAllow  = "allow"
+	controlCharsReject = "reject"
+	controlCharsStrip  = "strip"
+)
+
+// checkControlChars rejects or strips control characters (null bytes, newlines, etc.) in the retailer
+// and item descriptions so they can't break downstream CSV or log output
+func checkControlChars(r *receipt, settings settings) error {
+	clean := func(value string, field string) (string, error) {
+		if strings.IndexFunc(value, unicode.IsControl) < 0 {
+			return value, nil
+		}
+		if settings.ControlChars == controlCharsReject {
+			return "", errors.New(field + " must not contain control characters")
+		}
+		return strings.Map(func(char rune) rune {
+			if unicode.IsControl(char) {
+				return -1
+			}
+			return char
+		}, value), nil
+	}
+
+	retailer, err := clean(r.Retailer, "retailer")
+	if err != nil {
+		return err
+	}
+	r.Retailer = retailer
+
+	for i := range r.Items {
+		description, err := clean(r.Items[i].ShortDescription, "shortDescription")
+		if err != nil {
+			return err
+		}
+		r.Items[i].ShortDescription = description
+	}
+	return nil
+}
+
+// validateReceipt runs every enabled validator in the registry against a newly submitted receipt
+func validateReceipt(r *receipt, settings settings) error {
+	for _, validator := range receiptValidators {
+		if !validator.Enabled(settings) {
+			continue
+		}
+		if err := validator.Check(r, settings); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkFutureDate rejects receipts purchased after the current date
+func checkFutureDate(r *receipt, settings settings) error {
+	purchaseDate, err := parsePurchaseDate(r.PurchaseDate, settings.DateLayouts)
+	if err != nil {
+		return err
+	}
+
+	// compare calendar dates in the configured timezone (UTC by default)
+	year, month, day := now().In(settings.Timezone).Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	if purchaseDate.After(today) {
+		return errors.New("purchaseDate is in the future")
+	}
+	return nil
+}
+
+// validatorStatus represents a registered validator and whether it is enabled
+type validatorStatus struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+}
+
+// getValidators sends the names of the registered receipt validators and whether each is enabled
+func getValidators(context *gin.Context) {
+	validators := make([]validatorStatus, 0, len(receiptValidators))
+	for _, validator := range receiptValidators {
+		validators = append(validators, validatorStatus{Name: validator.Name, Enabled: validator.Enabled(appSettings)})
+	}
+	respondJSON(context, http.StatusOK, gin.H{"validators": validators})
+}
+
+// batchValidation is the outcome of validating one receipt in a batch
+type batchValidation struct {
+	Index  int      `json:"index"`
+	Valid  bool     `json:"valid"`
+	Errors []string `json:"errors"`
+}
+
+// validateBatch takes in a JSON array of receipts and reports, per index, whether each would be accepted by
+// POST /receipts/process, without storing anything
+func validateBatch(context *gin.Context) {
+	var bodies []json.RawMessage
+	if err := context.ShouldBindJSON(&bodies); err != nil {
+		respondError(context, http.StatusBadRequest, "The request must be a JSON array of receipts", bindErrorDetails(err))
+		return
+	}
+	if !checkBatchSize(context, len(bodies)) {
+		return
+	}
+
+	results := make([]batchValidation, 0, len(bodies))
+	for i, body := range bodies {
+		result := batchValidation{Index: i, Valid: true, Errors: []string{}}
+		if err := validateReceiptJSON(body, context.GetHeader("X-Receipt-Schema")); err != nil {
+			result.Valid = false
+			result.Errors = append(result.Errors, err.Error())
+		}
+		results = append(results, result)
+	}
+
+	respondJSON(context, http.StatusOK, gin.H{"results": results})
+}
+
+// checkBatchSize rejects a bulk request with more entries than MAX_BATCH_SIZE with a 413.
+// On failure it writes the response and returns false.
+func checkBatchSize(context *gin.Context, size int) bool {
+	if appSettings.MaxBatchSize > 0 && size > appSettings.MaxBatchSize {
+		respondError(context, http.StatusRequestEntityTooLarge, "The batch has too many receipts",
+			gin.H{"size": size, "maxBatchSize": appSettings.MaxBatchSize})
+		return false
+	}
+	return true
+}
+
+// validateReceiptJSON decodes, migrates and validates a single receipt body the same way decodeReceipt does
+func validateReceiptJSON(body []byte, schemaHeader string) error {
+	if key := findDuplicateKey(body); key != "" {
+		return errors.New("duplicate key " + strconv.Quote(key))
+	}
+
+	var r receipt
+	if err := json.Unmarshal(body, &r); err != nil {
+		return err
+	}
+	version, err := declaredSchemaVersion(schemaHeader, &r)
+	if err != nil {
+		return err
+	}
+	applyDefaults(&r, version, appSettings)
+	if err := migrateReceipt(&r, version); err != nil {
+		return err
+	}
+	return validateReceipt(&r, appSettings)
+}
+
+// accepted values for the AMOUNT_FORMAT setting
+const (
+	amountFormatAny   = "any"
+	amountFormatExact = "exact"
+	amountFormatMax2  = "max2"
+)
+
+// amountRule is the pattern totals and prices must match in a strict amount format
+type amountRule struct {
+	pattern     *regexp.Regexp
+	description string
+}
+
+// amountRules maps each strict amount format to its rule; amountFormatAny has none
+var amountRules = map[string]amountRule{
+	amountFormatExact: {regexp.MustCompile(`^\d+\.\d{2}$`), "exactly two decimal places"},
+	amountFormatMax2:  {regexp.MustCompile(`^\d+(\.\d{1,2})?$`), "at most two decimal places"},
+}
+
+// checkAmounts validates the total and item prices against the amount format,
+// normalizing them to two decimal places in max2 mode
+func checkAmounts(r *receipt, format string) error {
+	rule, ok := amountRules[format]
+	if !ok {
+		return nil
+	}
+
+	normalize := func(amount string, field string) (string, error) {
+		if !rule.pattern.MatchString(amount) {
+			return "", errors.New(field + " must be an amount with " + rule.description)
+		}
+		if format != amountFormatMax2 {
+			return amount, nil
+		}
+
+		cents, err := parseCents(amount)
+		if err != nil {
+			return "", errors.New(field + " is not a valid amount")
+		}
+		return formatCents(cents), nil
+	}
+
+	total, err := normalize(r.Total, "total")
+	if err != nil {
+		return err
+	}
+	r.Total = total
+
+	for i := range r.Items {
+		price, err := normalize(r.Items[i].Price, "price")
+		if err != nil {
+			return err
+		}
+		r.Items[i].Price = price
+	}
+	return nil
+}
+
+// parsePurchaseDate parses a purchase date using the first of the accepted layouts that matches
+func parsePurchaseDate(value string, layouts []string) (time.Time, error) {
+	if len(layouts) == 0 {
+		layouts = []string{isoDateLayout}
+	}
+	if appSettings.LenientParsing {
+		value = padNumbers(value)
+	}
+
+	for _, layout := range layouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, errors.New("purchaseDate is not in an accepted date format")
+}
+
+// parsePurchaseTime parses a purchase time in the spec's 24-hour HH:MM format
+func parsePurchaseTime(value string) (time.Time, error) {
+	if appSettings.LenientParsing {
+		value = padNumbers(value)
+	}
+
+	// time.Parse accepts a single-digit hour for "15", so the length check keeps strict mode to HH:MM
+	purchaseTime, err := time.Parse("15:04", value)
+	if err != nil || len(value) != len("15:04") {
+		return time.Time{}, errors.New("purchaseTime must be in HH:MM format")
+	}
+	return purchaseTime, nil
+}
+
+// unpaddedNumber matches a lone digit not preceded or followed by another digit
+var unpaddedNumber = regexp.MustCompile(`(^|\D)(\d)(\D|$)`)
+
+// padNumbers zero-pads single-digit date/time components, e.g. "2024-3-7" to "2024-03-07" and "9:05" to "09:05"
+func padNumbers(value string) string {
+	// run twice since adjacent matches like "3-7" share a separator
+	for i := 0; i < 2; i++ {
+		value = unpaddedNumber.ReplaceAllString(value, "${1}0${2}${3}")
+	}
+	return value
+}
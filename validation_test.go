@@ -0,0 +1,551 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixedNow stubs the clock at the given time for the rest of the test
+func fixedNow(t *testing.T, at time.Time) {
+	t.Helper()
+	now = func() time.Time { return at }
+	t.Cleanup(func() { now = time.Now })
+}
+
+func TestCheckFutureDate(t *testing.T) {
+	fixedNow(t, time.Date(2024, 3, 10, 2, 0, 0, 0, time.UTC))
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("timezone data unavailable")
+	}
+
+	tests := []struct {
+		name     string
+		date     string
+		timezone *time.Location
+		valid    bool
+	}{
+		{"past", "2024-03-09", time.UTC, true},
+		{"today", "2024-03-10", time.UTC, true},
+		{"future", "2024-03-11", time.UTC, false},
+		// it is still 2024-03-09 in New York
+		{"today in UTC is future in timezone", "2024-03-10", newYork, false},
+		{"today in timezone", "2024-03-09", newYork, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			settings := defaultSettings()
+			settings.Timezone = test.timezone
+			err := checkFutureDate(&receipt{PurchaseDate: test.date}, settings)
+			if (err == nil) != test.valid {
+				t.Errorf("checkFutureDate(%s) = %v, want valid %t", test.date, err, test.valid)
+			}
+		})
+	}
+}
+
+func TestProcessRejectsFutureDates(t *testing.T) {
+	resetState(t)
+	fixedNow(t, time.Date(2021, 12, 31, 12, 0, 0, 0, time.UTC))
+	if recorder := doRequest(t, http.MethodPost, "/receipts/process", targetReceipt); recorder.Code != http.StatusOK {
+		t.Errorf("future date accepted with %d while disabled, want 200", recorder.Code)
+	}
+
+	appSettings.RejectFutureDates = true
+	if recorder := doRequest(t, http.MethodPost, "/receipts/process", targetReceipt); recorder.Code != http.StatusBadRequest {
+		t.Errorf("future date returned %d, want 400", recorder.Code)
+	}
+}
+
+func TestParsePurchaseDateLayouts(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		layouts []string
+		want    string
+	}{
+		{"default ISO", "2024-03-07", nil, "2024-03-07"},
+		{"alternate layout", "03/07/2024", []string{"01/02/2006"}, "2024-03-07"},
+		{"either of two layouts", "2024-03-07", []string{"01/02/2006", isoDateLayout}, "2024-03-07"},
+		{"alternate date under default layout", "03/07/2024", nil, ""},
+		{"ISO date under alternate layout", "2024-03-07", []string{"01/02/2006"}, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			date, err := parsePurchaseDate(test.value, test.layouts)
+			if test.want == "" {
+				if err == nil {
+					t.Errorf("parsePurchaseDate(%q) = %v, want an error", test.value, date)
+				}
+				return
+			}
+			if err != nil || date.Format(isoDateLayout) != test.want {
+				t.Errorf("parsePurchaseDate(%q) = %v, %v, want %s", test.value, date, err, test.want)
+			}
+		})
+	}
+}
+
+func TestProcessAlternateDateLayout(t *testing.T) {
+	resetState(t)
+	body := withFields(t, targetReceipt, map[string]interface{}{"purchaseDate": "03/07/2024"})
+	if recorder := doRequest(t, http.MethodPost, "/receipts/process", body); recorder.Code != http.StatusBadRequest {
+		t.Errorf("MM/DD/YYYY date under the default layout returned %d, want 400", recorder.Code)
+	}
+
+	// the 7th is odd, so the receipt earns the same 28 points as the spec's 2022-01-01 example
+	appSettings.DateLayouts = []string{"01/02/2006"}
+	if points := testPoints(t, processTestReceipt(t, body)); points != 28 {
+		t.Errorf("points = %d, want 28", points)
+	}
+}
+
+func TestLenientParsing(t *testing.T) {
+	tests := []struct {
+		name    string
+		date    string
+		time    string
+		lenient bool
+		valid   bool
+	}{
+		{"padded strict", "2022-01-01", "09:01", false, true},
+		{"unpadded date strict", "2024-3-7", "09:01", false, false},
+		{"unpadded time strict", "2022-01-01", "9:05", false, false},
+		{"missing time strict", "2022-01-01", "", false, false},
+		{"unpadded date lenient", "2024-3-7", "09:01", true, true},
+		{"unpadded time lenient", "2022-01-01", "9:05", true, true},
+		{"unpadded minutes lenient", "2022-01-01", "9:1", true, true},
+		{"missing time lenient", "2022-01-01", "", true, true},
+		{"invalid date lenient", "2022-13-1", "09:01", true, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetState(t)
+			appSettings.LenientParsing = test.lenient
+			body := withFields(t, targetReceipt, map[string]interface{}{"purchaseDate": test.date, "purchaseTime": test.time})
+			recorder := doRequest(t, http.MethodPost, "/receipts/process", body)
+			if valid := recorder.Code == http.StatusOK; valid != test.valid {
+				t.Errorf("process %s %s returned %d, want valid %t", test.date, test.time, recorder.Code, test.valid)
+			}
+		})
+	}
+}
+
+func TestLenientParsingScoresNormalizedValues(t *testing.T) {
+	resetState(t)
+	appSettings.LenientParsing = true
+	// 2022-3-5 14:5 reads as 2022-03-05 14:05: an odd day in the afternoon window
+	body := withFields(t, targetReceipt, map[string]interface{}{"purchaseDate": "2022-3-5", "purchaseTime": "14:5"})
+	if points := testPoints(t, processTestReceipt(t, body)); points != 38 {
+		t.Errorf("points = %d, want 38", points)
+	}
+}
+
+func TestCheckAmountsMax2(t *testing.T) {
+	tests := []struct {
+		amount     string
+		normalized string
+	}{
+		{"1", "1.00"},
+		{"1.5", "1.50"},
+		{"1.55", "1.55"},
+		{"1.555", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.amount, func(t *testing.T) {
+			r := &receipt{Total: test.amount, Items: []item{{ShortDescription: "Dew", Price: test.amount}}}
+			err := checkAmounts(r, amountFormatMax2)
+			if test.normalized == "" {
+				if err == nil {
+					t.Errorf("checkAmounts accepted %q", test.amount)
+				}
+				return
+			}
+			if err != nil || r.Total != test.normalized || r.Items[0].Price != test.normalized {
+				t.Errorf("checkAmounts(%q) = %v with total %q and price %q, want %q",
+					test.amount, err, r.Total, r.Items[0].Price, test.normalized)
+			}
+		})
+	}
+}
+
+// allValidatorSettings returns settings enabling every registered validator
+func allValidatorSettings() settings {
+	s := defaultSettings()
+	s.ControlChars = controlCharsStrip
+	s.WholeDollarTotals = wholeDollarNormalize
+	s.AmountFormat = amountFormatMax2
+	s.RejectFutureDates = true
+	s.MinRetailerLength = 1
+	s.MaxItemPriceCents = 100000
+	return s
+}
+
+func TestValidatorRegistryRunsEveryValidator(t *testing.T) {
+	resetState(t)
+	scoringConfig.NonParticipatingAction = "reject"
+	enabled := allValidatorSettings()
+
+	registered := receiptValidators
+	defer func() { receiptValidators = registered }()
+	ran := []string{}
+	receiptValidators = nil
+	for _, validator := range registered {
+		validator := validator
+		if !validator.Enabled(enabled) {
+			t.Errorf("validator %s isn't enabled", validator.Name)
+		}
+		check := validator.Check
+		validator.Check = func(r *receipt, settings settings) error {
+			ran = append(ran, validator.Name)
+			return check(r, settings)
+		}
+		receiptValidators = append(receiptValidators, validator)
+	}
+
+	r := specReceipt(t, targetReceipt)
+	if err := validateReceipt(r, enabled); err != nil {
+		t.Fatalf("validateReceipt rejected the spec example: %v", err)
+	}
+	if len(ran) != len(registered) {
+		t.Errorf("ran %v, want all %d validators", ran, len(registered))
+	}
+}
+
+func TestGetValidators(t *testing.T) {
+	resetState(t)
+	recorder := doRequest(t, http.MethodGet, "/validators", "")
+	var response struct {
+		Validators []validatorStatus `json:"validators"`
+	}
+	decodeBody(t, recorder, &response)
+	listed := response.Validators
+
+	if len(listed) != len(receiptValidators) {
+		t.Fatalf("listed %d validators, want %d", len(listed), len(receiptValidators))
+	}
+	for i, validator := range receiptValidators {
+		if listed[i].Name != validator.Name || listed[i].Enabled != validator.Enabled(appSettings) {
+			t.Errorf("validator %d = %+v, want %s enabled %t", i, listed[i], validator.Name, validator.Enabled(appSettings))
+		}
+	}
+}
+
+func TestCheckControlChars(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        string
+		retailer    string
+		description string
+		want        receipt
+		valid       bool
+	}{
+		{"null byte rejected", controlCharsReject, "Tar\x00get", "Dew", receipt{}, false},
+		{"newline rejected", controlCharsReject, "Target", "Mountain\nDew", receipt{}, false},
+		{"null byte stripped", controlCharsStrip, "Tar\x00get", "Dew", receipt{Retailer: "Target", Items: []item{{ShortDescription: "Dew"}}}, true},
+		{"newline stripped", controlCharsStrip, "Target", "Mountain\nDew", receipt{Retailer: "Target", Items: []item{{ShortDescription: "MountainDew"}}}, true},
+		{"clean", controlCharsReject, "Target", "Dew", receipt{Retailer: "Target", Items: []item{{ShortDescription: "Dew"}}}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			settings := defaultSettings()
+			settings.ControlChars = test.mode
+			r := &receipt{Retailer: test.retailer, Items: []item{{ShortDescription: test.description}}}
+			err := checkControlChars(r, settings)
+			if (err == nil) != test.valid {
+				t.Fatalf("checkControlChars = %v, want valid %t", err, test.valid)
+			}
+			if test.valid && (r.Retailer != test.want.Retailer || r.Items[0].ShortDescription != test.want.Items[0].ShortDescription) {
+				t.Errorf("sanitized to %q / %q, want %q / %q", r.Retailer, r.Items[0].ShortDescription,
+					test.want.Retailer, test.want.Items[0].ShortDescription)
+			}
+		})
+	}
+}
+
+func TestWholeDollarTotals(t *testing.T) {
+	body := withFields(t, cornerMarketReceipt, map[string]interface{}{"total": "35"})
+
+	resetState(t)
+	appSettings.WholeDollarTotals = wholeDollarReject
+	if recorder := doRequest(t, http.MethodPost, "/receipts/process", body); recorder.Code != http.StatusBadRequest {
+		t.Errorf("strict mode returned %d for total 35, want 400", recorder.Code)
+	}
+
+	resetState(t)
+	appSettings.WholeDollarTotals = wholeDollarNormalize
+	id := processTestReceipt(t, body)
+	if r, _ := store.get(id); r.Total != "35.00" {
+		t.Errorf("stored total = %q, want 35.00", r.Total)
+	}
+	// the round-dollar and quarter bonuses still apply, just as for the 9.00 spec example
+	if points := testPoints(t, id); points != 109 {
+		t.Errorf("points = %d, want 109", points)
+	}
+}
+
+func TestMaxItemPrice(t *testing.T) {
+	// the Target example's priciest item is $12.25
+	tests := []struct {
+		name    string
+		maximum int
+		status  int
+	}{
+		{"disabled", 0, http.StatusOK},
+		{"at the maximum", 1225, http.StatusOK},
+		{"above the maximum", 1224, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetState(t)
+			appSettings.MaxItemPriceCents = test.maximum
+			if recorder := doRequest(t, http.MethodPost, "/receipts/process", targetReceipt); recorder.Code != test.status {
+				t.Errorf("process returned %d, want %d", recorder.Code, test.status)
+			}
+		})
+	}
+}
+
+func TestCheckRetailerLength(t *testing.T) {
+	tests := []struct {
+		name     string
+		minimum  int
+		retailer string
+		valid    bool
+	}{
+		{"empty at the default", 1, "", false},
+		{"one character at the default", 1, "T", true},
+		{"below", 3, "Ta", false},
+		{"at", 3, "Tar", true},
+		{"multi-byte at", 3, "日本堂", true},
+		{"multi-byte below", 3, "日本", false},
+		{"padded below", 3, "  Ta  ", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			settings := defaultSettings()
+			settings.MinRetailerLength = test.minimum
+			if err := checkRetailerLength(&receipt{Retailer: test.retailer}, settings); (err == nil) != test.valid {
+				t.Errorf("checkRetailerLength(%q) = %v, want valid %t", test.retailer, err, test.valid)
+			}
+		})
+	}
+}
+
+func TestProcessRejectsRetailerStrippedEmpty(t *testing.T) {
+	resetState(t)
+	appSettings.ControlChars = controlCharsStrip
+	body := withFields(t, targetReceipt, map[string]interface{}{"retailer": "\x07\x07"})
+	if recorder := doRequest(t, http.MethodPost, "/receipts/process", body); recorder.Code != http.StatusBadRequest {
+		t.Errorf("retailer of only control characters returned %d, want 400", recorder.Code)
+	}
+}
+
+func TestValidateBatch(t *testing.T) {
+	resetState(t)
+	body := "[" + strings.Join([]string{
+		targetReceipt,
+		`{"retailer": ""}`,
+		cornerMarketReceipt,
+		`{"retailer": "Target", "retailer": "Costco"}`,
+		`"not a receipt"`,
+	}, ",") + "]"
+
+	recorder := doRequest(t, http.MethodPost, "/receipts/validate/batch", body)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("validate returned %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var response struct {
+		Results []batchValidation `json:"results"`
+	}
+	decodeBody(t, recorder, &response)
+
+	valid := []bool{true, false, true, false, false}
+	if len(response.Results) != len(valid) {
+		t.Fatalf("got %d results, want %d", len(response.Results), len(valid))
+	}
+	for i, result := range response.Results {
+		if result.Index != i || result.Valid != valid[i] || (len(result.Errors) == 0) != valid[i] {
+			t.Errorf("result %d = %+v, want valid %t with errors only when invalid", i, result, valid[i])
+		}
+	}
+	if count := len(store.list()); count != 0 {
+		t.Errorf("validation stored %d receipts, want none", count)
+	}
+
+	if recorder := doRequest(t, http.MethodPost, "/receipts/validate/batch", targetReceipt); recorder.Code != http.StatusBadRequest {
+		t.Errorf("a body that isn't an array returned %d, want 400", recorder.Code)
+	}
+}
+
+func TestValidateBatchSizeCap(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int
+		status int
+	}{
+		{"at the cap", 3, http.StatusOK},
+		{"above the cap", 4, http.StatusRequestEntityTooLarge},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetState(t)
+			appSettings.MaxBatchSize = 3
+			receipts := make([]string, test.size)
+			for i := range receipts {
+				receipts[i] = targetReceipt
+			}
+			body := "[" + strings.Join(receipts, ",") + "]"
+			if recorder := doRequest(t, http.MethodPost, "/receipts/validate/batch", body); recorder.Code != test.status {
+				t.Errorf("batch of %d returned %d, want %d", test.size, recorder.Code, test.status)
+			}
+		})
+	}
+
+	if settings := defaultSettings(); settings.MaxBatchSize != 1000 {
+		t.Errorf("default max batch size = %d, want 1000", settings.MaxBatchSize)
+	}
+}
+
+func TestMaxTotal(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		total  string
+		status int
+	}{
+		{"normal", amountFormatAny, "35.35", http.StatusOK},
+		{"at the default maximum", amountFormatAny, "1000000.00", http.StatusOK},
+		{"above the default maximum", amountFormatAny, "1000000.01", http.StatusBadRequest},
+		{"beyond int64 cents", amountFormatAny, "99999999999999999999.99", http.StatusBadRequest},
+		// totals the maximum can't read are left to the amount format
+		{"three decimals with any format", amountFormatAny, "35.355", http.StatusOK},
+		{"no leading digit with any format", amountFormatAny, ".50", http.StatusOK},
+		{"exponent with exact format", amountFormatExact, "1e30", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetState(t)
+			appSettings.AmountFormat = test.format
+			body := withFields(t, targetReceipt, map[string]interface{}{"total": test.total})
+			if recorder := doRequest(t, http.MethodPost, "/receipts/process", body); recorder.Code != test.status {
+				t.Errorf("total %s returned %d, want %d", test.total, recorder.Code, test.status)
+			}
+		})
+	}
+}
+
+func TestReceiptNote(t *testing.T) {
+	resetState(t)
+	appSettings.MaxNoteLength = 5
+	note := "café!" // 5 characters, 6 bytes
+
+	id := processTestReceipt(t, withFields(t, targetReceipt, map[string]interface{}{"note": note}))
+	var listed []receipt
+	decodeBody(t, doRequest(t, http.MethodGet, "/receipts", ""), &listed)
+	if len(listed) != 1 || listed[0].Note != note {
+		t.Errorf("listed %+v, want the note %q returned", listed, note)
+	}
+	if points := testPoints(t, id); points != 28 {
+		t.Errorf("points = %d, want the note not to affect scoring", points)
+	}
+
+	body := withFields(t, targetReceipt, map[string]interface{}{"note": note + "!"})
+	if recorder := doRequest(t, http.MethodPost, "/receipts/process", body); recorder.Code != http.StatusBadRequest {
+		t.Errorf("note over the maximum returned %d, want 400", recorder.Code)
+	}
+}
+
+func TestCheckAmountPrefixes(t *testing.T) {
+	tests := []struct {
+		amount  string
+		lenient bool
+		want    string
+		valid   bool
+	}{
+		{"+35.00", false, "", false},
+		{"035.00", false, "", false},
+		{"+35.00", true, "35.00", true},
+		{"035.00", true, "35.00", true},
+		{"+0035.00", true, "35.00", true},
+		{"00.50", true, "0.50", true},
+		{"+0.00", true, "0.00", true},
+		{"0.50", false, "0.50", true},
+		{"35.00", false, "35.00", true},
+	}
+	for _, test := range tests {
+		settings := defaultSettings()
+		settings.LenientParsing = test.lenient
+		r := &receipt{Total: test.amount, Items: []item{{ShortDescription: "Dew", Price: test.amount}}}
+		err := checkAmountPrefixes(r, settings)
+		if (err == nil) != test.valid {
+			t.Errorf("checkAmountPrefixes(%q, lenient %t) = %v, want valid %t", test.amount, test.lenient, err, test.valid)
+			continue
+		}
+		if test.valid && (r.Total != test.want || r.Items[0].Price != test.want) {
+			t.Errorf("checkAmountPrefixes(%q) normalized to %q / %q, want %q", test.amount, r.Total, r.Items[0].Price, test.want)
+		}
+	}
+}
+
+func TestProcessPrefixedTotal(t *testing.T) {
+	body := withFields(t, cornerMarketReceipt, map[string]interface{}{"total": "+009.00"})
+
+	resetState(t)
+	if recorder := doRequest(t, http.MethodPost, "/receipts/process", body); recorder.Code != http.StatusBadRequest {
+		t.Errorf("strict mode returned %d for total +009.00, want 400", recorder.Code)
+	}
+
+	resetState(t)
+	appSettings.LenientParsing = true
+	if points := testPoints(t, processTestReceipt(t, body)); points != 109 {
+		t.Errorf("points = %d, want 109 as for the 9.00 example", points)
+	}
+}
+
+func TestCheckDescriptionPattern(t *testing.T) {
+	lettersOnly := regexp.MustCompile(`^[A-Za-z ]+$`)
+
+	tests := []struct {
+		name        string
+		pattern     *regexp.Regexp
+		description string
+		valid       bool
+	}{
+		{"spec compliant", specDescriptionPattern, "Klarbrunn 12-PK 12 FL OZ", true},
+		{"spec compliant with padding", specDescriptionPattern, "   Klarbrunn 12-PK 12 FL OZ  ", true},
+		{"spec non-compliant", specDescriptionPattern, "Ben & Jerry's", false},
+		{"spec non-compliant punctuation", specDescriptionPattern, "Dew!", false},
+		{"custom compliant", lettersOnly, "Mountain Dew", true},
+		{"custom non-compliant", lettersOnly, "Mountain Dew 12PK", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			settings := defaultSettings()
+			settings.DescriptionPattern = test.pattern
+			r := &receipt{Items: []item{{ShortDescription: "Dew"}, {ShortDescription: test.description}}}
+			if err := checkDescriptionPattern(r, settings); (err == nil) != test.valid {
+				t.Errorf("checkDescriptionPattern(%q) = %v, want valid %t", test.description, err, test.valid)
+			}
+		})
+	}
+}
+
+func TestDescriptionPatternSetting(t *testing.T) {
+	t.Setenv("DESCRIPTION_PATTERN", `^[a-z]+$`)
+	settings, err := loadSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.DescriptionPattern.String() != `^[a-z]+$` {
+		t.Errorf("pattern = %s, want ^[a-z]+$", settings.DescriptionPattern)
+	}
+
+	t.Setenv("DESCRIPTION_PATTERN", `^[a-z+$`)
+	if _, err := loadSettings(); err == nil {
+		t.Error("accepted an invalid DESCRIPTION_PATTERN")
+	}
+}